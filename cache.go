@@ -0,0 +1,149 @@
+package main
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// nearNowWindow is how far into the future a guide window can be and still
+// be considered "near-now" — these windows are refreshed on every run since
+// zap2it schedules close to air time change often. Windows further out are
+// subject to the configured cache TTL instead.
+const nearNowWindow = 24 * 60 * 60
+
+// cacheEnvelope is the on-disk representation of a cached guide window: the
+// raw JSON response plus the bookkeeping needed to honor the TTL and detect
+// unchanged content on the next run.
+type cacheEnvelope struct {
+	Hash      string          `json:"hash"`
+	FetchedAt int64           `json:"fetchedAt"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// cacheKey derives the cache filename for a guide window from the lineup,
+// headend and window start time, so cached windows for one lineup never
+// collide with another.
+func cacheKey(lineupId, headendId string, windowStart int64) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%s|%d", lineupId, headendId, windowStart)))
+	return hex.EncodeToString(sum[:])
+}
+
+// cachePath returns the on-disk path for a cached window, namespaced by
+// provider so zap2it, Schedules Direct and HDHomeRun caches never collide
+// even if pointed at the same cache dir.
+func (z *Zap) cachePath(namespace, lineupId, headendId string, windowStart int64) string {
+	ext := ".json"
+	if z.cacheCompress {
+		ext += ".gz"
+	}
+	return filepath.Join(z.cacheDir, namespace, cacheKey(lineupId, headendId, windowStart)+ext)
+}
+
+// cacheTTLFor returns how long a cached copy of the given window is valid
+// for. Near-now windows always refresh; further-out windows are refreshed
+// at the configured cache TTL.
+func (z *Zap) cacheTTLFor(windowStart int64) time.Duration {
+	if windowStart-time.Now().Unix() < nearNowWindow {
+		return 0
+	}
+	return z.cacheTTL
+}
+
+// readCacheEnvelope returns the decoded envelope stored at path, regardless
+// of age, or false if path doesn't exist or can't be decoded.
+func (z *Zap) readCacheEnvelope(path string) (cacheEnvelope, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return cacheEnvelope{}, false
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if z.cacheCompress {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return cacheEnvelope{}, false
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	raw, err := ioutil.ReadAll(r)
+	if err != nil {
+		return cacheEnvelope{}, false
+	}
+
+	var env cacheEnvelope
+	if err := json.Unmarshal(raw, &env); err != nil {
+		return cacheEnvelope{}, false
+	}
+	return env, true
+}
+
+// readCache returns the cached JSON body for path if it exists and is
+// within ttl, unless --force-refresh was requested.
+func (z *Zap) readCache(path string, ttl time.Duration) ([]byte, bool) {
+	if z.forceRefresh || ttl <= 0 {
+		return nil, false
+	}
+
+	env, ok := z.readCacheEnvelope(path)
+	if !ok {
+		return nil, false
+	}
+	if time.Since(time.Unix(env.FetchedAt, 0)) > ttl {
+		return nil, false
+	}
+	return env.Data, true
+}
+
+// writeCache persists a freshly fetched guide window's JSON body to path,
+// gzip-compressing it when cacheCompress is enabled. If a cached copy
+// already on disk has the same content hash, the body itself is reused but
+// FetchedAt is still bumped to restart the TTL clock, so a window that
+// comes back unchanged is treated as freshly confirmed rather than being
+// re-fetched live on every run once its old TTL elapses.
+func (z *Zap) writeCache(path string, data []byte) error {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	if existing, ok := z.readCacheEnvelope(path); ok && existing.Hash == hash {
+		data = existing.Data
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	raw, err := json.Marshal(cacheEnvelope{
+		Hash:      hash,
+		FetchedAt: time.Now().Unix(),
+		Data:      data,
+	})
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if !z.cacheCompress {
+		_, err = f.Write(raw)
+		return err
+	}
+
+	gz := gzip.NewWriter(f)
+	defer gz.Close()
+	_, err = gz.Write(raw)
+	return err
+}
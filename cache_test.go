@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCacheTTLFor(t *testing.T) {
+	z := &Zap{cacheTTL: time.Hour}
+	now := time.Now().Unix()
+
+	if ttl := z.cacheTTLFor(now - 60*60*48); ttl != 0 {
+		t.Errorf("cacheTTLFor(48h in the past) = %v, want 0", ttl)
+	}
+	if ttl := z.cacheTTLFor(now + 60*60*12); ttl != 0 {
+		t.Errorf("cacheTTLFor(12h in the future) = %v, want 0 (near-now)", ttl)
+	}
+	if ttl := z.cacheTTLFor(now + 60*60*48); ttl != z.cacheTTL {
+		t.Errorf("cacheTTLFor(48h in the future) = %v, want configured TTL %v", ttl, z.cacheTTL)
+	}
+}
+
+func TestWriteCacheThenReadCacheRoundTrips(t *testing.T) {
+	z := &Zap{cacheDir: t.TempDir(), cacheTTL: time.Hour}
+	path := filepath.Join(z.cacheDir, "window.json")
+
+	if err := z.writeCache(path, []byte(`{"hello":"world"}`)); err != nil {
+		t.Fatalf("writeCache returned error: %v", err)
+	}
+
+	data, ok := z.readCache(path, z.cacheTTL)
+	if !ok {
+		t.Fatal("readCache = false, want true for a freshly written cache entry")
+	}
+	if string(data) != `{"hello":"world"}` {
+		t.Errorf("readCache data = %q, want %q", data, `{"hello":"world"}`)
+	}
+}
+
+func TestReadCacheMissesOnceTTLHasElapsed(t *testing.T) {
+	z := &Zap{cacheDir: t.TempDir(), cacheTTL: time.Hour}
+	path := filepath.Join(z.cacheDir, "window.json")
+
+	if err := z.writeCache(path, []byte(`{"a":1}`)); err != nil {
+		t.Fatalf("writeCache returned error: %v", err)
+	}
+	if _, ok := z.readCache(path, 0); ok {
+		t.Error("readCache = true with a zero TTL, want false")
+	}
+}
+
+func TestWriteCacheRestampsFetchedAtForUnchangedContent(t *testing.T) {
+	z := &Zap{cacheDir: t.TempDir(), cacheTTL: time.Hour}
+	path := filepath.Join(z.cacheDir, "window.json")
+
+	if err := z.writeCache(path, []byte(`{"a":1}`)); err != nil {
+		t.Fatalf("first writeCache returned error: %v", err)
+	}
+
+	// Age the entry out of the TTL by backdating FetchedAt directly, as if
+	// the clock had advanced since the first write.
+	env, ok := z.readCacheEnvelope(path)
+	if !ok {
+		t.Fatal("readCacheEnvelope = false after first writeCache, want true")
+	}
+	env.FetchedAt = time.Now().Add(-2 * z.cacheTTL).Unix()
+	raw, err := json.Marshal(env)
+	if err != nil {
+		t.Fatalf("Marshal backdated envelope returned error: %v", err)
+	}
+	if err := ioutil.WriteFile(path, raw, 0644); err != nil {
+		t.Fatalf("WriteFile backdated envelope returned error: %v", err)
+	}
+	if _, ok := z.readCache(path, z.cacheTTL); ok {
+		t.Fatal("readCache = true for a backdated entry, want false (TTL elapsed)")
+	}
+
+	// A no-op refresh with byte-identical content should still restart the
+	// TTL clock, since it confirms the window hasn't actually changed.
+	if err := z.writeCache(path, []byte(`{"a":1}`)); err != nil {
+		t.Fatalf("second writeCache returned error: %v", err)
+	}
+	data, ok := z.readCache(path, z.cacheTTL)
+	if !ok {
+		t.Fatal("readCache = false after unchanged-content refresh, want true (FetchedAt should be bumped)")
+	}
+	if string(data) != `{"a":1}` {
+		t.Errorf("readCache data = %q, want %q", data, `{"a":1}`)
+	}
+
+	// Changed content must still be persisted.
+	if err := z.writeCache(path, []byte(`{"a":2}`)); err != nil {
+		t.Fatalf("third writeCache returned error: %v", err)
+	}
+	data, ok = z.readCache(path, z.cacheTTL)
+	if !ok || string(data) != `{"a":2}` {
+		t.Errorf("readCache after content change = (%q, %v), want (%q, true)", data, ok, `{"a":2}`)
+	}
+}
+
+func TestCacheKeyIsStableAndDistinct(t *testing.T) {
+	a := cacheKey("lineup1", "headend1", 1000)
+	b := cacheKey("lineup1", "headend1", 1000)
+	if a != b {
+		t.Errorf("cacheKey is not deterministic: %q != %q", a, b)
+	}
+
+	if c := cacheKey("lineup2", "headend1", 1000); c == a {
+		t.Error("cacheKey collided across different lineup IDs")
+	}
+	if c := cacheKey("lineup1", "headend1", 2000); c == a {
+		t.Error("cacheKey collided across different window starts")
+	}
+}
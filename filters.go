@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/ini.v1"
+)
+
+// predicate is one clause of the filter DSL, e.g. `callSign =~ "^ESPN"` or
+// `channelNo in 2..99`.
+type predicate struct {
+	field string
+	op    string // "=~" or "in"
+	regex *regexp.Regexp
+	lo    float64
+	hi    float64
+}
+
+func (p predicate) matchString(value string) bool {
+	return p.op == "=~" && p.regex.MatchString(value)
+}
+
+func (p predicate) matchNumber(value float64) bool {
+	return p.op == "in" && value >= p.lo && value <= p.hi
+}
+
+// parsePredicate parses a single DSL clause: `field =~ "regex"` or
+// `field in lo..hi`.
+func parsePredicate(expr string) (predicate, error) {
+	expr = strings.TrimSpace(expr)
+
+	if idx := strings.Index(expr, "=~"); idx >= 0 {
+		field := strings.TrimSpace(expr[:idx])
+		pattern := strings.Trim(strings.TrimSpace(expr[idx+len("=~"):]), `"`)
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return predicate{}, fmt.Errorf("invalid regex in filter %q: %v", expr, err)
+		}
+		return predicate{field: field, op: "=~", regex: re}, nil
+	}
+
+	if idx := strings.Index(expr, " in "); idx >= 0 {
+		field := strings.TrimSpace(expr[:idx])
+		bounds := strings.SplitN(strings.TrimSpace(expr[idx+len(" in "):]), "..", 2)
+		if len(bounds) != 2 {
+			return predicate{}, fmt.Errorf("invalid range in filter %q, want lo..hi", expr)
+		}
+		lo, loErr := strconv.ParseFloat(strings.TrimSpace(bounds[0]), 64)
+		hi, hiErr := strconv.ParseFloat(strings.TrimSpace(bounds[1]), 64)
+		if loErr != nil || hiErr != nil {
+			return predicate{}, fmt.Errorf("invalid range bounds in filter %q", expr)
+		}
+		return predicate{field: field, op: "in", lo: lo, hi: hi}, nil
+	}
+
+	return predicate{}, fmt.Errorf("unrecognized filter predicate %q", expr)
+}
+
+// parsePredicateList parses a semicolon-separated list of DSL clauses. The
+// clauses are combined with OR semantics: a channel/programme matches the
+// list if it matches any one of them.
+func parsePredicateList(raw string) ([]predicate, error) {
+	var preds []predicate
+	for _, expr := range strings.Split(raw, ";") {
+		expr = strings.TrimSpace(expr)
+		if expr == "" {
+			continue
+		}
+		p, err := parsePredicate(expr)
+		if err != nil {
+			return nil, err
+		}
+		preds = append(preds, p)
+	}
+	return preds, nil
+}
+
+// filterSet holds the compiled channel and programme filters loaded from
+// the [filters] config section (and any --include-channel/--exclude-channel/
+// --exclude-programme flags).
+type filterSet struct {
+	channelInclude   []predicate
+	channelExclude   []predicate
+	programmeExclude []predicate
+
+	// includedChannels is the set of channel IDs that survived
+	// IncludesChannel, set once BuildGuide has written the <channel>
+	// elements. IncludesProgramme uses it to drop programmes whose
+	// channel was filtered out, so a programme never outlives its
+	// <channel> declaration in the written guide.
+	includedChannels map[string]bool
+}
+
+// SetIncludedChannels records the channel IDs BuildGuide actually wrote, so
+// IncludesProgramme can reject any programme referencing a channel that
+// didn't make it into the guide.
+func (fs *filterSet) SetIncludedChannels(ids []string) {
+	fs.includedChannels = make(map[string]bool, len(ids))
+	for _, id := range ids {
+		fs.includedChannels[id] = true
+	}
+}
+
+func loadFilterSet(cfg *ini.File) (*filterSet, error) {
+	fs := &filterSet{}
+	var err error
+	if fs.channelInclude, err = parsePredicateList(cfg.Section("filters").Key("channelInclude").String()); err != nil {
+		return nil, err
+	}
+	if fs.channelExclude, err = parsePredicateList(cfg.Section("filters").Key("channelExclude").String()); err != nil {
+		return nil, err
+	}
+	if fs.programmeExclude, err = parsePredicateList(cfg.Section("filters").Key("programmeExclude").String()); err != nil {
+		return nil, err
+	}
+	return fs, nil
+}
+
+func channelFieldValue(channel Channel, field string) (string, bool) {
+	switch field {
+	case "callSign":
+		return channel.CallSign, channel.CallSign != ""
+	case "affiliate":
+		return channel.Affiliate, channel.Affiliate != ""
+	case "channelNo":
+		return channel.ChannelNo, channel.ChannelNo != ""
+	}
+	return "", false
+}
+
+func matchesChannel(preds []predicate, channel Channel) bool {
+	for _, p := range preds {
+		if p.field == "channelNo" && p.op == "in" {
+			if channel.ChannelNo == "" {
+				continue
+			}
+			num, err := strconv.ParseFloat(channel.ChannelNo, 64)
+			if err != nil {
+				continue
+			}
+			if p.matchNumber(num) {
+				return true
+			}
+			continue
+		}
+		value, ok := channelFieldValue(channel, p.field)
+		if ok && p.matchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// IncludesChannel reports whether a channel should be kept: it must match
+// at least one include predicate (when any are configured) and no exclude
+// predicate.
+func (fs *filterSet) IncludesChannel(channel Channel) bool {
+	if len(fs.channelInclude) > 0 && !matchesChannel(fs.channelInclude, channel) {
+		return false
+	}
+	if len(fs.channelExclude) > 0 && matchesChannel(fs.channelExclude, channel) {
+		return false
+	}
+	return true
+}
+
+// matchesAnyTitle reports whether any of a programme's (possibly
+// multi-language) titles match p.
+func matchesAnyTitle(p predicate, titles []Title) bool {
+	for _, t := range titles {
+		if p.matchString(t.Text) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesAnyCategory reports whether any of a programme's categories match p.
+func matchesAnyCategory(p predicate, categories []Category) bool {
+	for _, c := range categories {
+		if p.matchString(c.Text) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesProgramme(preds []predicate, programme Programme) bool {
+	for _, p := range preds {
+		switch p.field {
+		case "title":
+			if matchesAnyTitle(p, programme.Title) {
+				return true
+			}
+		case "category":
+			if matchesAnyCategory(p, programme.Categories) {
+				return true
+			}
+		case "rating":
+			if programme.Rating != nil && programme.Rating.Value != nil && p.matchString(programme.Rating.Value.Text) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// IncludesProgramme reports whether a programme should be kept: its channel
+// must have survived channel filtering (when channel filtering ran), and it
+// must not match any configured programmeExclude predicate.
+func (fs *filterSet) IncludesProgramme(programme Programme) bool {
+	if fs.includedChannels != nil && !fs.includedChannels[programme.Channel] {
+		return false
+	}
+	return !matchesProgramme(fs.programmeExclude, programme)
+}
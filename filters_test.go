@@ -0,0 +1,133 @@
+package main
+
+import "testing"
+
+func TestParsePredicateRegex(t *testing.T) {
+	p, err := parsePredicate(`callSign =~ "^ESPN"`)
+	if err != nil {
+		t.Fatalf("parsePredicate returned error: %v", err)
+	}
+	if p.field != "callSign" || p.op != "=~" {
+		t.Fatalf("parsePredicate = %+v, want field=callSign op==~", p)
+	}
+	if !p.matchString("ESPN2") {
+		t.Error("expected regex to match ESPN2")
+	}
+	if p.matchString("FOX") {
+		t.Error("expected regex not to match FOX")
+	}
+}
+
+func TestParsePredicateRange(t *testing.T) {
+	p, err := parsePredicate("channelNo in 2..99")
+	if err != nil {
+		t.Fatalf("parsePredicate returned error: %v", err)
+	}
+	if p.field != "channelNo" || p.op != "in" {
+		t.Fatalf("parsePredicate = %+v, want field=channelNo op=in", p)
+	}
+	if !p.matchNumber(50) {
+		t.Error("expected 50 to be in range 2..99")
+	}
+	if p.matchNumber(100) {
+		t.Error("expected 100 not to be in range 2..99")
+	}
+}
+
+func TestParsePredicateErrors(t *testing.T) {
+	cases := []string{
+		"",
+		"channelNo in 2",
+		"channelNo in abc..99",
+		`callSign =~ "("`,
+	}
+	for _, expr := range cases {
+		if _, err := parsePredicate(expr); err == nil {
+			t.Errorf("parsePredicate(%q) = nil error, want an error", expr)
+		}
+	}
+}
+
+func TestParsePredicateListORsClauses(t *testing.T) {
+	preds, err := parsePredicateList(`callSign =~ "^ESPN"; channelNo in 2..5`)
+	if err != nil {
+		t.Fatalf("parsePredicateList returned error: %v", err)
+	}
+	if len(preds) != 2 {
+		t.Fatalf("parsePredicateList returned %d predicates, want 2", len(preds))
+	}
+}
+
+func TestParsePredicateListSkipsBlankClauses(t *testing.T) {
+	preds, err := parsePredicateList(`callSign =~ "^ESPN"; ; `)
+	if err != nil {
+		t.Fatalf("parsePredicateList returned error: %v", err)
+	}
+	if len(preds) != 1 {
+		t.Fatalf("parsePredicateList returned %d predicates, want 1", len(preds))
+	}
+}
+
+func TestIncludesChannel(t *testing.T) {
+	fs := &filterSet{
+		channelInclude: []predicate{{field: "channelNo", op: "in", lo: 2, hi: 10}},
+		channelExclude: []predicate{mustPredicate(t, `callSign =~ "^SHOP"`)},
+	}
+
+	if !fs.IncludesChannel(Channel{ChannelNo: "5", CallSign: "ESPN"}) {
+		t.Error("expected channel 5/ESPN to be included")
+	}
+	if fs.IncludesChannel(Channel{ChannelNo: "20", CallSign: "ESPN"}) {
+		t.Error("expected channel 20 to be excluded (outside include range)")
+	}
+	if fs.IncludesChannel(Channel{ChannelNo: "5", CallSign: "SHOPNOW"}) {
+		t.Error("expected SHOPNOW to be excluded")
+	}
+}
+
+func TestIncludesProgramme(t *testing.T) {
+	fs := &filterSet{
+		programmeExclude: []predicate{mustPredicate(t, `title =~ "Infomercial"`)},
+	}
+
+	if !fs.IncludesProgramme(Programme{Title: []Title{{Text: "Nightly News"}}}) {
+		t.Error("expected Nightly News to be included")
+	}
+	if fs.IncludesProgramme(Programme{Title: []Title{{Text: "Infomercial Hour"}}}) {
+		t.Error("expected Infomercial Hour to be excluded")
+	}
+}
+
+func TestIncludesProgrammeDropsProgrammesForExcludedChannels(t *testing.T) {
+	fs := &filterSet{
+		channelExclude: []predicate{mustPredicate(t, `callSign =~ "^SHOP"`)},
+	}
+
+	channels := []Channel{
+		{ID: "1", CallSign: "ESPN"},
+		{ID: "2", CallSign: "SHOPNOW"},
+	}
+	var includedIDs []string
+	for _, c := range channels {
+		if fs.IncludesChannel(c) {
+			includedIDs = append(includedIDs, c.ID)
+		}
+	}
+	fs.SetIncludedChannels(includedIDs)
+
+	if !fs.IncludesProgramme(Programme{Channel: "1", Title: []Title{{Text: "SportsCenter"}}}) {
+		t.Error("expected programme on surviving channel 1 to be included")
+	}
+	if fs.IncludesProgramme(Programme{Channel: "2", Title: []Title{{Text: "Big Sale"}}}) {
+		t.Error("expected programme on excluded channel 2 to be dropped")
+	}
+}
+
+func mustPredicate(t *testing.T, expr string) predicate {
+	t.Helper()
+	p, err := parsePredicate(expr)
+	if err != nil {
+		t.Fatalf("parsePredicate(%q) returned error: %v", expr, err)
+	}
+	return p
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// hdHomeRunGuideURL is SiliconDust's hosted EPG endpoint for HDHomeRun
+// devices. It takes the account's DeviceAuth token plus an optional Start
+// Unix timestamp and returns that device's over-the-air lineup's guide for
+// the following few hours.
+const hdHomeRunGuideURL = "https://api.hdhomerun.com/api/guide"
+
+// hdHomeRunProvider implements Provider against SiliconDust's HDHomeRun
+// guide API, pairing a DeviceAuth token with a tuner's own over-the-air
+// lineup to return a proper EPG — synopses and artwork a bare OTA signal
+// never carries.
+type hdHomeRunProvider struct {
+	z *Zap
+
+	// guideMu guards guideCache, an in-process memo of guide results keyed
+	// by window start time, so Channels reading the earliest window for
+	// its channel list doesn't cost Programmes a second live fetch of that
+	// same window.
+	guideMu    sync.Mutex
+	guideCache map[int64][]hdGuideChannel
+}
+
+type hdGuideChannel struct {
+	GuideNumber string         `json:"GuideNumber"`
+	GuideName   string         `json:"GuideName"`
+	Affiliate   string         `json:"Affiliate"`
+	ImageURL    string         `json:"ImageURL"`
+	Guide       []hdGuideEntry `json:"Guide"`
+}
+
+type hdGuideEntry struct {
+	StartTime       int64    `json:"StartTime"`
+	EndTime         int64    `json:"EndTime"`
+	Title           string   `json:"Title"`
+	EpisodeTitle    string   `json:"EpisodeTitle"`
+	EpisodeNumber   string   `json:"EpisodeNumber"`
+	Synopsis        string   `json:"Synopsis"`
+	ImageURL        string   `json:"ImageURL"`
+	OriginalAirdate int64    `json:"OriginalAirdate"`
+	Filter          []string `json:"Filter"`
+}
+
+// Authenticate is a no-op beyond a config sanity check: the DeviceAuth
+// token from [hdhomerun] deviceAuth is a long-lived credential tied to the
+// device, not a session to log into.
+func (p *hdHomeRunProvider) Authenticate(ctx context.Context) error {
+	if p.z.config.Section("hdhomerun").Key("deviceAuth").String() == "" {
+		return fmt.Errorf("[hdhomerun] deviceAuth is required")
+	}
+	return nil
+}
+
+// guide fetches (or reuses a cached copy of) the guide window starting at
+// windowStart for every channel the configured device can see. Results are
+// also memoized in-process for the lifetime of p, so a window fetched once
+// (e.g. by Channels) is never fetched live a second time by Programmes.
+func (p *hdHomeRunProvider) guide(ctx context.Context, windowStart int64) ([]hdGuideChannel, error) {
+	p.guideMu.Lock()
+	if channels, ok := p.guideCache[windowStart]; ok {
+		p.guideMu.Unlock()
+		return channels, nil
+	}
+	p.guideMu.Unlock()
+
+	deviceAuth := p.z.config.Section("hdhomerun").Key("deviceAuth").String()
+	cachePath := p.z.cachePath("hdhomerun", deviceAuth, "", windowStart)
+	ttl := p.z.cacheTTLFor(windowStart)
+
+	var bodyBytes []byte
+	if cached, ok := p.z.readCache(cachePath, ttl); ok {
+		bodyBytes = cached
+	} else {
+		p.z.limiter.Wait()
+
+		fetched, err := p.z.doWithRetry(ctx, func(ctx context.Context) (*http.Request, error) {
+			url := fmt.Sprintf("%s?DeviceAuth=%s&Start=%d", hdHomeRunGuideURL, deviceAuth, windowStart)
+			return http.NewRequestWithContext(ctx, "GET", url, nil)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error fetching HDHomeRun guide: %v", err)
+		}
+		bodyBytes = fetched
+
+		if err := p.z.writeCache(cachePath, bodyBytes); err != nil {
+			fmt.Printf("warning: failed to write cache for window %d: %v\n", windowStart, err)
+		}
+	}
+
+	var channels []hdGuideChannel
+	if err := json.Unmarshal(bodyBytes, &channels); err != nil {
+		return nil, fmt.Errorf("error parsing JSON: %v", err)
+	}
+
+	p.guideMu.Lock()
+	if p.guideCache == nil {
+		p.guideCache = map[int64][]hdGuideChannel{}
+	}
+	p.guideCache[windowStart] = channels
+	p.guideMu.Unlock()
+
+	return channels, nil
+}
+
+// Channels fetches the first guide window purely to read off its channel
+// list, the same trick zap2itProvider uses, since HDHomeRun's guide API
+// bundles channels into every window's response too. guide's in-process
+// memo means this fetch is reused by Programmes rather than repeated.
+func (p *hdHomeRunProvider) Channels(ctx context.Context) ([]Channel, error) {
+	startTime, _ := p.z.GetGuideTimes()
+	guideChannels, err := p.guide(ctx, startTime)
+	if err != nil {
+		return nil, err
+	}
+
+	var channels []Channel
+	for _, gc := range guideChannels {
+		channel := Channel{
+			ID: gc.GuideNumber,
+			DisplayName: []string{
+				fmt.Sprintf("%s %s", gc.GuideNumber, gc.GuideName),
+				gc.GuideNumber,
+				gc.GuideName,
+				strings.Title(gc.Affiliate),
+			},
+			CallSign:  gc.GuideName,
+			ChannelNo: gc.GuideNumber,
+			Affiliate: gc.Affiliate,
+		}
+		if gc.ImageURL != "" {
+			channel.Icon = &Icon{Src: gc.ImageURL}
+		}
+		channels = append(channels, channel)
+	}
+	return channels, nil
+}
+
+func (p *hdHomeRunProvider) Programmes(ctx context.Context, window guideWindow) ([]Programme, error) {
+	guideChannels, err := p.guide(ctx, window.Start)
+	if err != nil {
+		return nil, err
+	}
+
+	// HDHomeRun's guide API has no notion of localized alternatives — every
+	// field comes back in English regardless of this guide's configured
+	// languages — so fields are tagged "en" rather than this guide's first
+	// preference, which could silently mislabel English text as some other
+	// language.
+	const lang = "en"
+	var programmes []Programme
+	for _, gc := range guideChannels {
+		for _, entry := range gc.Guide {
+			if entry.StartTime < window.Start || entry.StartTime >= window.End {
+				continue
+			}
+			programmes = append(programmes, hdBuildProgramme(gc.GuideNumber, entry, lang))
+		}
+	}
+	return programmes, nil
+}
+
+func hdBuildProgramme(channelID string, entry hdGuideEntry, lang string) Programme {
+	programme := Programme{
+		Channel: channelID,
+		Start:   hdBuildXMLDate(entry.StartTime),
+		Stop:    hdBuildXMLDate(entry.EndTime),
+		Title:   []Title{{Lang: lang, Text: entry.Title}},
+	}
+
+	if entry.EpisodeTitle != "" {
+		programme.SubTitle = []SubTitle{{Lang: lang, Text: entry.EpisodeTitle}}
+	}
+	if entry.Synopsis != "" {
+		programme.Desc = []Desc{{Lang: lang, Text: entry.Synopsis}}
+	}
+	if entry.ImageURL != "" {
+		programme.Icon = &Icon{Src: entry.ImageURL}
+	}
+	for _, genre := range entry.Filter {
+		if genre == "" {
+			continue
+		}
+		programme.Categories = append(programme.Categories, Category{Lang: lang, Text: genre})
+	}
+	if entry.OriginalAirdate > 0 {
+		programme.Date = &Date{Text: time.Unix(entry.OriginalAirdate, 0).UTC().Format("20060102")}
+	}
+	if num := hdBuildEpisodeNum(entry.EpisodeNumber); num != nil {
+		programme.EpisodeNums = []EpisodeNum{*num}
+	}
+
+	return programme
+}
+
+// hdBuildEpisodeNum converts HDHomeRun's "S01E02"-style episode number into
+// an XMLTV onscreen episode-num element.
+func hdBuildEpisodeNum(raw string) *EpisodeNum {
+	if raw == "" {
+		return nil
+	}
+	return &EpisodeNum{System: "onscreen", Text: raw}
+}
+
+func hdBuildXMLDate(unixSeconds int64) string {
+	return time.Unix(unixSeconds, 0).UTC().Format("20060102150405 -0700")
+}
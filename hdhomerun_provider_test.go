@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gopkg.in/ini.v1"
+)
+
+func TestHdBuildXMLDate(t *testing.T) {
+	got := hdBuildXMLDate(1785326400)
+	want := time.Unix(1785326400, 0).UTC().Format("20060102150405 -0700")
+	if got != want {
+		t.Errorf("hdBuildXMLDate = %q, want %q", got, want)
+	}
+}
+
+func TestHdBuildEpisodeNum(t *testing.T) {
+	if num := hdBuildEpisodeNum(""); num != nil {
+		t.Errorf("hdBuildEpisodeNum(\"\") = %+v, want nil", num)
+	}
+	num := hdBuildEpisodeNum("S01E02")
+	if num == nil || num.System != "onscreen" || num.Text != "S01E02" {
+		t.Errorf("hdBuildEpisodeNum(S01E02) = %+v, want {onscreen S01E02}", num)
+	}
+}
+
+func TestHdBuildProgrammeMapsEveryField(t *testing.T) {
+	entry := hdGuideEntry{
+		StartTime:       1785326400,
+		EndTime:         1785330000,
+		Title:           "SportsCenter",
+		EpisodeTitle:    "Top Plays",
+		EpisodeNumber:   "S01E02",
+		Synopsis:        "Highlights from around the league.",
+		ImageURL:        "http://example.com/sc.png",
+		OriginalAirdate: 1735689600,
+		Filter:          []string{"Sports", "", "News"},
+	}
+
+	programme := hdBuildProgramme("5.1", entry, "en")
+
+	if programme.Channel != "5.1" {
+		t.Errorf("Channel = %q, want 5.1", programme.Channel)
+	}
+	if len(programme.Title) != 1 || programme.Title[0].Text != "SportsCenter" {
+		t.Errorf("Title = %+v, want SportsCenter", programme.Title)
+	}
+	if len(programme.SubTitle) != 1 || programme.SubTitle[0].Text != "Top Plays" {
+		t.Errorf("SubTitle = %+v, want Top Plays", programme.SubTitle)
+	}
+	if len(programme.Desc) != 1 || programme.Desc[0].Text != entry.Synopsis {
+		t.Errorf("Desc = %+v, want %q", programme.Desc, entry.Synopsis)
+	}
+	if programme.Icon == nil || programme.Icon.Src != entry.ImageURL {
+		t.Errorf("Icon = %+v, want Src=%q", programme.Icon, entry.ImageURL)
+	}
+	if len(programme.Categories) != 2 {
+		t.Errorf("Categories = %+v, want 2 entries (blank genre skipped)", programme.Categories)
+	}
+	if programme.Date == nil || programme.Date.Text != "20250101" {
+		t.Errorf("Date = %+v, want 20250101", programme.Date)
+	}
+	if len(programme.EpisodeNums) != 1 || programme.EpisodeNums[0].Text != "S01E02" {
+		t.Errorf("EpisodeNums = %+v, want [{onscreen S01E02}]", programme.EpisodeNums)
+	}
+}
+
+func TestHdBuildProgrammeOmitsAbsentOptionalFields(t *testing.T) {
+	entry := hdGuideEntry{StartTime: 1785326400, EndTime: 1785330000, Title: "News at Noon"}
+	programme := hdBuildProgramme("5.1", entry, "en")
+
+	if programme.SubTitle != nil || programme.Desc != nil || programme.Icon != nil ||
+		programme.Categories != nil || programme.Date != nil || programme.EpisodeNums != nil {
+		t.Errorf("hdBuildProgramme with a bare entry = %+v, want all optional fields nil", programme)
+	}
+}
+
+func TestProgrammesTagEnRegardlessOfConfiguredLanguages(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"GuideNumber":"5.1","GuideName":"ESPN","Guide":[{"StartTime":1785326400,"EndTime":1785330000,"Title":"SportsCenter"}]}]`))
+	}))
+	defer server.Close()
+
+	target, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("url.Parse returned error: %v", err)
+	}
+	cfg := ini.Empty()
+	if _, err := cfg.Section("hdhomerun").NewKey("deviceAuth", "test-device-auth"); err != nil {
+		t.Fatalf("NewKey returned error: %v", err)
+	}
+	z := &Zap{
+		httpClient: &http.Client{Transport: &rewriteTransport{target: target}},
+		limiter:    newRateLimiter(1000),
+		cacheDir:   t.TempDir(),
+		cacheTTL:   time.Hour,
+		config:     cfg,
+		// HDHomeRun's guide API has no localized alternatives, so the
+		// user's preferred languages must not change what gets reported.
+		langs: []string{"es", "fr"},
+	}
+	p := &hdHomeRunProvider{z: z}
+
+	programmes, err := p.Programmes(context.Background(), guideWindow{Start: 1785326400, End: 1785330000})
+	if err != nil {
+		t.Fatalf("Programmes returned error: %v", err)
+	}
+	if len(programmes) != 1 || len(programmes[0].Title) != 1 || programmes[0].Title[0].Lang != "en" {
+		t.Errorf("Programmes = %+v, want a single title tagged lang=en", programmes)
+	}
+}
+
+func TestGuideCachesToDiskAndMemoizesWithinProcess(t *testing.T) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Write([]byte(`[{"GuideNumber":"5.1","GuideName":"ESPN","Guide":[]}]`))
+	}))
+	defer server.Close()
+
+	target, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("url.Parse returned error: %v", err)
+	}
+	cfg := ini.Empty()
+	_, err = cfg.Section("hdhomerun").NewKey("deviceAuth", "test-device-auth")
+	if err != nil {
+		t.Fatalf("NewKey returned error: %v", err)
+	}
+	z := &Zap{
+		httpClient: &http.Client{Transport: &rewriteTransport{target: target}},
+		limiter:    newRateLimiter(1000),
+		cacheDir:   t.TempDir(),
+		cacheTTL:   time.Hour,
+		config:     cfg,
+	}
+
+	// Beyond nearNowWindow so cacheTTLFor returns a real TTL instead of 0,
+	// otherwise readCache would never consider the on-disk copy valid.
+	windowStart := time.Now().Unix() + 2*24*60*60
+
+	ctx := context.Background()
+	p1 := &hdHomeRunProvider{z: z}
+	if _, err := p1.guide(ctx, windowStart); err != nil {
+		t.Fatalf("guide returned error: %v", err)
+	}
+	// A second call on the same provider instance should hit the
+	// in-process memo, not the disk cache or the network.
+	if _, err := p1.guide(ctx, windowStart); err != nil {
+		t.Fatalf("second guide call returned error: %v", err)
+	}
+	if got := atomic.LoadInt32(&hits); got != 1 {
+		t.Errorf("guide endpoint was hit %d times after two same-instance calls, want 1", got)
+	}
+
+	// A fresh provider instance has no in-process memo, so this only stays
+	// at 1 hit if the on-disk cache is actually being used.
+	p2 := &hdHomeRunProvider{z: z}
+	if _, err := p2.guide(ctx, windowStart); err != nil {
+		t.Fatalf("guide call on second provider returned error: %v", err)
+	}
+	if got := atomic.LoadInt32(&hits); got != 1 {
+		t.Errorf("guide endpoint was hit %d times across provider instances, want 1 (second instance should have used the on-disk cache)", got)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	requestTimeout = 30 * time.Second
+	maxRetries     = 4
+	baseRetryDelay = 500 * time.Millisecond
+)
+
+// newHTTPClient builds the *http.Client shared by Authenticate, GetData and
+// FindID. A client-level timeout is kept as a backstop in case a caller
+// forgets to wrap its context, but each request should supply its own
+// shorter, cancellable context via doWithRetry.
+func newHTTPClient() *http.Client {
+	return &http.Client{Timeout: 60 * time.Second}
+}
+
+// rateLimiter is a minimal token-bucket limiter used to cap how many
+// zap2it requests are in flight per second across the worker pool.
+type rateLimiter struct {
+	mu     chan struct{}
+	tokens float64
+	max    float64
+	rate   float64
+	last   time.Time
+}
+
+// newRateLimiter returns a limiter that allows requestsPerSecond requests to
+// proceed per second, with bursts up to that same size.
+func newRateLimiter(requestsPerSecond float64) *rateLimiter {
+	if requestsPerSecond <= 0 {
+		requestsPerSecond = 1
+	}
+	return &rateLimiter{
+		mu:     make(chan struct{}, 1),
+		tokens: requestsPerSecond,
+		max:    requestsPerSecond,
+		rate:   requestsPerSecond,
+		last:   time.Now(),
+	}
+}
+
+// Wait blocks until a token is available, refilling the bucket based on
+// elapsed time since it was last drawn from.
+func (r *rateLimiter) Wait() {
+	for {
+		r.mu <- struct{}{}
+		now := time.Now()
+		r.tokens += now.Sub(r.last).Seconds() * r.rate
+		if r.tokens > r.max {
+			r.tokens = r.max
+		}
+		r.last = now
+
+		if r.tokens >= 1 {
+			r.tokens--
+			<-r.mu
+			return
+		}
+
+		wait := time.Duration((1 - r.tokens) / r.rate * float64(time.Second))
+		<-r.mu
+		time.Sleep(wait)
+	}
+}
+
+// isRetryableStatus reports whether an HTTP response status indicates a
+// transient server-side failure worth retrying.
+func isRetryableStatus(statusCode int) bool {
+	return statusCode >= 500
+}
+
+// isRetryableErr reports whether a request error is a timeout or other
+// temporary network failure worth retrying.
+func isRetryableErr(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return netErr.Timeout() || netErr.Temporary()
+	}
+	return false
+}
+
+// backoffWithJitter returns an exponential backoff duration for the given
+// retry attempt (0-indexed), with up to 50% random jitter to avoid retry
+// storms across concurrent workers.
+func backoffWithJitter(attempt int) time.Duration {
+	backoff := baseRetryDelay * time.Duration(1<<uint(attempt))
+	jitter := time.Duration(rand.Int63n(int64(backoff)/2 + 1))
+	return backoff + jitter
+}
+
+// doWithRetry executes a request built by buildReq, retrying with
+// exponential backoff on 5xx responses and temporary/timeout network
+// errors. buildReq is called fresh on every attempt so it can bind a new
+// per-attempt context, derived from parent so a caller can still cancel
+// the whole retry loop.
+func (z *Zap) doWithRetry(parent context.Context, buildReq func(ctx context.Context) (*http.Request, error)) ([]byte, error) {
+	var lastErr error
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		ctx, cancel := context.WithTimeout(parent, requestTimeout)
+		req, err := buildReq(ctx)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+
+		resp, err := z.httpClient.Do(req)
+		if err != nil {
+			cancel()
+			lastErr = err
+			if !isRetryableErr(err) {
+				return nil, err
+			}
+		} else {
+			body, readErr := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			cancel()
+			if !isRetryableStatus(resp.StatusCode) {
+				return body, readErr
+			}
+			lastErr = fmt.Errorf("received retryable status %d", resp.StatusCode)
+		}
+
+		if attempt < maxRetries {
+			time.Sleep(backoffWithJitter(attempt))
+		}
+	}
+	return nil, fmt.Errorf("request failed after %d attempts: %v", maxRetries+1, lastErr)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBackoffWithJitterGrowsExponentially(t *testing.T) {
+	for attempt := 0; attempt < maxRetries; attempt++ {
+		base := baseRetryDelay * time.Duration(1<<uint(attempt))
+		maxDelay := base + base/2 + 1
+		for i := 0; i < 20; i++ {
+			got := backoffWithJitter(attempt)
+			if got < base {
+				t.Fatalf("attempt %d: backoffWithJitter returned %v, want at least %v", attempt, got, base)
+			}
+			if got > maxDelay {
+				t.Fatalf("attempt %d: backoffWithJitter returned %v, want at most %v", attempt, got, maxDelay)
+			}
+		}
+	}
+}
+
+func TestDoWithRetrySucceedsAfterTransientServerErrors(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	z := &Zap{httpClient: newHTTPClient()}
+	body, err := z.doWithRetry(context.Background(), func(ctx context.Context) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	})
+	if err != nil {
+		t.Fatalf("doWithRetry returned error: %v", err)
+	}
+	if string(body) != "ok" {
+		t.Errorf("doWithRetry body = %q, want %q", body, "ok")
+	}
+	if got := atomic.LoadInt32(&attempts); got != 3 {
+		t.Errorf("server saw %d attempts, want 3 (two failures then a success)", got)
+	}
+}
+
+func TestDoWithRetryGivesUpAfterMaxRetries(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	z := &Zap{httpClient: newHTTPClient()}
+	_, err := z.doWithRetry(context.Background(), func(ctx context.Context) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	})
+	if err == nil {
+		t.Fatal("doWithRetry returned nil error, want one after exhausting retries against an always-failing server")
+	}
+	if got := atomic.LoadInt32(&attempts); got != maxRetries+1 {
+		t.Errorf("server saw %d attempts, want %d", got, maxRetries+1)
+	}
+}
+
+func TestIsRetryableStatus(t *testing.T) {
+	cases := map[int]bool{
+		200: false,
+		301: false,
+		404: false,
+		429: false,
+		500: true,
+		502: true,
+		503: true,
+	}
+	for status, want := range cases {
+		if got := isRetryableStatus(status); got != want {
+			t.Errorf("isRetryableStatus(%d) = %v, want %v", status, got, want)
+		}
+	}
+}
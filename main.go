@@ -1,16 +1,16 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
 	"encoding/xml"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
-	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/spf13/pflag"
@@ -18,13 +18,21 @@ import (
 )
 
 type Zap struct {
-	confLocation string
-	outputFile   string
-	config       *ini.File
-	lang         string
-	zapToken     string
-	headendID    string
-	guideXML     Tv
+	confLocation   string
+	outputFile     string
+	config         *ini.File
+	langs          []string
+	httpClient     *http.Client
+	limiter        *rateLimiter
+	cacheDir       string
+	cacheTTL       time.Duration
+	cacheCompress  bool
+	forceRefresh   bool
+	filters        *filterSet
+	provider       Provider
+	sourceInfoName string
+	sourceInfoURL  string
+	writer         *guideWriter
 }
 
 func GuideScrape(configLocation, outputFile string) (*Zap, error) {
@@ -38,210 +46,138 @@ func GuideScrape(configLocation, outputFile string) (*Zap, error) {
 		return nil, fmt.Errorf("failed to read config: %s\nCheck file permissions", configLocation)
 	}
 
-	lang := cfg.Section("prefs").Key("lang").MustString("en")
+	langs := parseLanguages(cfg.Section("prefs").Key("languages").MustString(cfg.Section("prefs").Key("lang").MustString("en")))
+	requestsPerSecond := cfg.Section("prefs").Key("requestsPerSecond").MustFloat64(2)
 
-	return &Zap{
-		confLocation: configLocation,
-		outputFile:   outputFile,
-		config:       cfg,
-		lang:         lang,
-	}, nil
-}
-
-func (z *Zap) BuildAuthRequest() (*http.Request, error) {
-	urlStr := "https://tvlistings.zap2it.com/api/user/login"
-	data := url.Values{
-		"emailid":        {z.config.Section("creds").Key("username").String()},
-		"password":       {z.config.Section("creds").Key("password").String()},
-		"isfacebookuser": {"false"},
-		"usertype":       {"0"},
-		"objectid":       {""},
-	}
+	cacheDir := cfg.Section("cache").Key("dir").MustString("./.cache")
+	cacheTTL := time.Duration(cfg.Section("cache").Key("ttlHours").MustInt(6)) * time.Hour
+	cacheCompress := cfg.Section("cache").Key("compress").MustBool(true)
 
-	req, err := http.NewRequest("POST", urlStr, strings.NewReader(data.Encode()))
+	filters, err := loadFilterSet(cfg)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	return req, nil
-}
 
-func (z *Zap) Authenticate() error {
-	req, err := z.BuildAuthRequest()
-	if err != nil {
-		return err
+	z := &Zap{
+		confLocation:  configLocation,
+		outputFile:    outputFile,
+		config:        cfg,
+		langs:         langs,
+		httpClient:    newHTTPClient(),
+		limiter:       newRateLimiter(requestsPerSecond),
+		cacheDir:      cacheDir,
+		cacheTTL:      cacheTTL,
+		cacheCompress: cacheCompress,
+		filters:       filters,
 	}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("error connecting to tvlistings.zap2it.com: %v", err)
-	}
-	defer resp.Body.Close()
-
-	bodyBytes, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("error reading response body: %v", err)
-	}
-
-	var authFormVars map[string]interface{}
-	if err := json.Unmarshal(bodyBytes, &authFormVars); err != nil {
-		return fmt.Errorf("error parsing JSON: %v", err)
-	}
-
-	z.zapToken = authFormVars["token"].(string)
-	properties := authFormVars["properties"].(map[string]interface{})
-	z.headendID = properties["2004"].(string)
-	return nil
-}
-
-func (z *Zap) BuildIDRequest() (*http.Request, error) {
-	urlStr := fmt.Sprintf("https://tvlistings.zap2it.com/gapzap_webapi/api/Providers/getPostalCodeProviders/%s/%s/gapzap/%s",
-		z.config.Section("prefs").Key("country").String(),
-		z.config.Section("prefs").Key("zipCode").String(),
-		z.config.Section("prefs").Key("lang").MustString("en-us"))
-
-	req, err := http.NewRequest("GET", urlStr, nil)
+	provider, err := newProvider(z)
 	if err != nil {
 		return nil, err
 	}
-	return req, nil
-}
-
-func (z *Zap) FindID() error {
-	req, err := z.BuildIDRequest()
-	if err != nil {
-		return err
-	}
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("error loading provider IDs: %v", err)
-	}
-	defer resp.Body.Close()
+	z.provider = provider
 
-	bodyBytes, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("error reading response body: %v", err)
-	}
+	return z, nil
+}
 
-	var idVars map[string]interface{}
-	if err := json.Unmarshal(bodyBytes, &idVars); err != nil {
-		return fmt.Errorf("error parsing JSON: %v", err)
+// parseLanguages splits a comma-separated list of BCP-47 language tags into
+// a preference-ordered slice, trimming whitespace and dropping empty tags.
+func parseLanguages(raw string) []string {
+	var langs []string
+	for _, lang := range strings.Split(raw, ",") {
+		lang = strings.TrimSpace(lang)
+		if lang != "" {
+			langs = append(langs, lang)
+		}
 	}
-
-	fmt.Printf("%-15s|%-40s|%-15s|%-15s|%-25s|%-15s\n", "type", "name", "location", "headendID", "lineupId", "device")
-	for _, p := range idVars["Providers"].([]interface{}) {
-		provider := p.(map[string]interface{})
-		fmt.Printf("%-15s|%-40s|%-15s|%-15s|%-25s|%-15s\n",
-			provider["type"],
-			provider["name"],
-			provider["location"],
-			provider["headendId"],
-			provider["lineupId"],
-			provider["device"])
+	if len(langs) == 0 {
+		langs = []string{"en"}
 	}
-	return nil
+	return langs
 }
 
-func (z *Zap) BuildDataRequest(currentTime int64) (*http.Request, error) {
-	lineupId := z.config.Section("lineup").Key("lineupId").MustString(z.headendID)
-	headendId := z.config.Section("lineup").Key("headendId").MustString("lineupId")
-	device := z.config.Section("lineup").Key("device").MustString("-")
-
-	params := url.Values{
-		"Activity_ID":  {"1"},
-		"FromPage":     {"TV Guide"},
-		"AffiliateId":  {"gapzap"},
-		"token":        {z.zapToken},
-		"aid":          {"gapzap"},
-		"lineupId":     {lineupId},
-		"timespan":     {"3"}, // was 3
-		"headendId":    {headendId},
-		"country":      {z.config.Section("prefs").Key("country").String()},
-		"device":       {device},
-		"postalCode":   {z.config.Section("prefs").Key("zipCode").String()},
-		"isOverride":   {"true"},
-		"time":         {fmt.Sprintf("%d", currentTime*1)}, // was * 1000
-		"pref":         {"m,p"},
-		"userId":       {"-"},
-		"languagecode": {"en-us"},
-		"TMSID":        {""},
-		"OVDID":        {""},
-	}
-
-	urlStr := "https://tvlistings.zap2it.com/api/grid?" + params.Encode()
-
-	// fmt.Println(urlStr)
-	req, err := http.NewRequest("GET", urlStr, nil)
-	if err != nil {
-		return nil, err
+// ResolveLanguage picks the best matching text for a set of preferred
+// languages out of a map of available localized alternatives, falling back
+// to English and then to any available entry if no preferred language
+// matches. Downstream consumers of the generated guide can apply the same
+// fallback chain zap2itXMLTV uses when building it.
+func ResolveLanguage(preferred []string, available map[string]string) (lang, text string) {
+	for _, p := range preferred {
+		if t, ok := available[p]; ok {
+			return p, t
+		}
 	}
-	return req, nil
-}
-
-func (z *Zap) GetData(currentTime int64) (map[string]interface{}, error) {
-	req, err := z.BuildDataRequest(currentTime)
-	if err != nil {
-		return nil, err
+	if t, ok := available["en"]; ok {
+		return "en", t
 	}
-
-	fmt.Printf("Load Guide for time: %d\n", currentTime)
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("error fetching data: %v", err)
+	for lang, text := range available {
+		return lang, text
 	}
-	defer resp.Body.Close()
+	return "", ""
+}
 
-	bodyBytes, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("error reading response body: %v", err)
+// selectLanguages narrows a map of available localized text down to the
+// languages this guide prefers, in preference order. If none of the
+// available languages are preferred, it falls back to ResolveLanguage so a
+// single best-effort language is still emitted.
+func (z *Zap) selectLanguages(available map[string]string) []string {
+	var selected []string
+	for _, lang := range z.langs {
+		if _, ok := available[lang]; ok {
+			selected = append(selected, lang)
+		}
 	}
-
-	// fmt.Println(string(bodyBytes))
-
-	var data map[string]interface{}
-	if err := json.Unmarshal(bodyBytes, &data); err != nil {
-		return nil, fmt.Errorf("error parsing JSON: %v", err)
+	if len(selected) == 0 {
+		if lang, _ := ResolveLanguage(z.langs, available); lang != "" {
+			selected = append(selected, lang)
+		}
 	}
-
-	return data, nil
+	return selected
 }
 
+// Tv carries the <tv> root element's attributes. Its Channel and Programme
+// children are streamed to disk individually by guideWriter rather than
+// being held here, so a Tv value only ever describes the header.
 type Tv struct {
-	XMLName           xml.Name    `xml:"tv"`
-	SourceInfoURL     string      `xml:"source-info-url,attr"`
-	SourceInfoName    string      `xml:"source-info-name,attr"`
-	GeneratorInfoName string      `xml:"generator-info-name,attr"`
-	GeneratorInfoURL  string      `xml:"generator-info-url,attr"`
-	Channels          []Channel   `xml:"channel"`
-	Programmes        []Programme `xml:"programme"`
+	XMLName           xml.Name `xml:"tv"`
+	SourceInfoURL     string   `xml:"source-info-url,attr"`
+	SourceInfoName    string   `xml:"source-info-name,attr"`
+	GeneratorInfoName string   `xml:"generator-info-name,attr"`
+	GeneratorInfoURL  string   `xml:"generator-info-url,attr"`
 }
 
 type Channel struct {
+	XMLName     xml.Name `xml:"channel"`
 	ID          string   `xml:"id,attr"`
 	DisplayName []string `xml:"display-name"`
 	Icon        *Icon    `xml:"icon,omitempty"`
+	CallSign    string   `xml:"-"`
+	ChannelNo   string   `xml:"-"`
+	Affiliate   string   `xml:"-"`
 }
 
 type Programme struct {
+	XMLName         xml.Name     `xml:"programme"`
 	Start           string       `xml:"start,attr"`
 	Stop            string       `xml:"stop,attr"`
 	Channel         string       `xml:"channel,attr"`
 	Title           []Title      `xml:"title"`
-	SubTitle        *SubTitle    `xml:"sub-title,omitempty"`
-	Desc            *Desc        `xml:"desc,omitempty"`
+	SubTitle        []SubTitle   `xml:"sub-title,omitempty"`
+	Desc            []Desc       `xml:"desc,omitempty"`
+	Credits         *Credits     `xml:"credits,omitempty"`
+	Date            *Date        `xml:"date,omitempty"`
 	Length          *Length      `xml:"length,omitempty"`
 	Icon            *Icon        `xml:"icon,omitempty"`
 	URL             *URL         `xml:"url,omitempty"`
 	Categories      []Category   `xml:"category,omitempty"`
 	EpisodeNums     []EpisodeNum `xml:"episode-num,omitempty"`
+	Video           *Video       `xml:"video,omitempty"`
+	Audio           *Audio       `xml:"audio,omitempty"`
 	New             *struct{}    `xml:"new,omitempty"`
 	PreviouslyShown *struct{}    `xml:"previously-shown,omitempty"`
 	Subtitles       *Subtitles   `xml:"subtitles,omitempty"`
 	Rating          *Rating      `xml:"rating,omitempty"`
+	StarRating      *StarRating  `xml:"star-rating,omitempty"`
 }
 
 type Title struct {
@@ -287,6 +223,11 @@ type Subtitles struct {
 }
 
 type Rating struct {
+	System string `xml:"system,attr,omitempty"`
+	Value  *Value `xml:"value,omitempty"`
+}
+
+type StarRating struct {
 	Value *Value `xml:"value,omitempty"`
 }
 
@@ -294,219 +235,187 @@ type Value struct {
 	Text string `xml:",chardata"`
 }
 
-func (z *Zap) BuildRootEl() {
-	z.guideXML = Tv{
-		SourceInfoURL:     "http://tvlistings.zap2it.com/",
-		SourceInfoName:    "zap2it",
-		GeneratorInfoName: "zap2itXMLTV",
-		GeneratorInfoURL:  "https://github.com/spf13/zap2itxmltv",
-	}
+type Credits struct {
+	Director []string `xml:"director,omitempty"`
+	Actor    []Actor  `xml:"actor,omitempty"`
+	Writer   []string `xml:"writer,omitempty"`
+	Producer []string `xml:"producer,omitempty"`
+	Guest    []string `xml:"guest,omitempty"`
 }
 
-func (z *Zap) BuildGuide() error {
-	if err := z.Authenticate(); err != nil {
-		return err
-	}
-
-	z.BuildRootEl()
-
-	addChannels := true
-	startTime, endTime := z.GetGuideTimes()
-	for currentTime := startTime; currentTime < endTime; currentTime += 60 * 60 * 3 {
-		data, err := z.GetData(currentTime)
-		if err != nil {
-			return err
-		}
-		// fmt.Println(data)
-		if addChannels {
-			if err := z.AddChannelsToGuide(data); err != nil {
-				return err
-			}
-			addChannels = false
-		}
-		if err := z.AddEventsToGuide(data); err != nil {
-			return err
-		}
-	}
-
-	if err := z.WriteGuide(); err != nil {
-		return err
-	}
-	if err := z.CopyHistorical(); err != nil {
-		return err
-	}
-	if err := z.CleanHistorical(); err != nil {
-		return err
-	}
-
-	return nil
+type Actor struct {
+	Role string `xml:"role,attr,omitempty"`
+	Text string `xml:",chardata"`
 }
 
-func (z *Zap) GetGuideTimes() (int64, int64) {
-	currentTimestamp := time.Now().Unix()
-	currentTimestamp -= 60 * 60 * 24
-	halfHourOffset := currentTimestamp % (60 * 30)
-	currentTimestamp -= halfHourOffset
-	endTimestamp := currentTimestamp + (60 * 60 * 336)
-	return currentTimestamp, endTimestamp
+type Date struct {
+	Text string `xml:",chardata"`
 }
 
-func (z *Zap) AddChannelsToGuide(data map[string]interface{}) error {
-
-	channels, ok := data["channels"].([]interface{})
-	if !ok {
-		return fmt.Errorf("channels not found in data")
-	}
-	for _, c := range channels {
-		channelData := c.(map[string]interface{})
-		channel, err := z.BuildChannelXML(channelData)
-		if err != nil {
-			return err
-		}
-		z.guideXML.Channels = append(z.guideXML.Channels, channel)
-	}
-	return nil
+type Video struct {
+	Quality string `xml:"quality,omitempty"`
 }
 
-func (z *Zap) BuildChannelXML(channelData map[string]interface{}) (Channel, error) {
-	channel := Channel{
-		ID: channelData["channelId"].(string),
-		DisplayName: []string{
-			fmt.Sprintf("%s %s", channelData["channelNo"], channelData["callSign"]),
-			channelData["channelNo"].(string),
-			channelData["callSign"].(string),
-			strings.Title(channelData["affiliateName"].(string)),
-		},
-	}
-
-	thumbnail := channelData["thumbnail"].(string)
-	thumbnailURL := "http://" + strings.TrimLeft(strings.Split(thumbnail, "?")[0], "/")
-	channel.Icon = &Icon{Src: thumbnailURL}
-
-	return channel, nil
+type Audio struct {
+	Stereo string `xml:"stereo,omitempty"`
 }
 
-func (z *Zap) AddEventsToGuide(data map[string]interface{}) error {
-	channels, ok := data["channels"].([]interface{})
-	if !ok {
-		return fmt.Errorf("channels not found in data")
-	}
-	for _, c := range channels {
-		channelData := c.(map[string]interface{})
-		channelID := channelData["channelId"].(string)
-		events, ok := channelData["events"].([]interface{})
-		if !ok {
-			continue
-		}
-		for _, e := range events {
-			eventData := e.(map[string]interface{})
-			programme, err := z.BuildEventXML(eventData, channelID)
-			if err != nil {
-				return err
-			}
-			z.guideXML.Programmes = append(z.guideXML.Programmes, programme)
-		}
-	}
-	return nil
-}
+func (z *Zap) BuildGuide() error {
+	ctx := context.Background()
 
-// safeGetString safely extracts a string from a map
-func safeGetString(m map[string]interface{}, key string) (string, bool) {
-	val, exists := m[key]
-	if !exists {
-		return "", false
+	if err := z.provider.Authenticate(ctx); err != nil {
+		return err
 	}
-	str, ok := val.(string)
-	return str, ok
-}
 
-// safeGetMap safely extracts a nested map from a map
-func safeGetMap(m map[string]interface{}, key string) (map[string]interface{}, bool) {
-	val, exists := m[key]
-	if !exists {
-		return nil, false
+	writer, err := newGuideWriter(z.outputFile)
+	if err != nil {
+		return err
 	}
-	subMap, ok := val.(map[string]interface{})
-	return subMap, ok
-}
+	z.writer = writer
 
-// newProgramme creates a new Programme with required fields
-func newProgramme(channelID string) Programme {
-	return Programme{
-		Channel: channelID,
+	if err := writer.WriteHeader(Tv{
+		SourceInfoURL:     z.sourceInfoURL,
+		SourceInfoName:    z.sourceInfoName,
+		GeneratorInfoName: "zap2itXMLTV",
+		GeneratorInfoURL:  "https://github.com/spf13/zap2itxmltv",
+	}); err != nil {
+		writer.Abort()
+		return err
 	}
-}
 
-func (z *Zap) BuildEventXML(eventData map[string]interface{}, channelID string) (Programme, error) {
-	if eventData == nil {
-		return Programme{}, fmt.Errorf("eventData is nil")
+	channels, err := z.provider.Channels(ctx)
+	if err != nil {
+		writer.Abort()
+		return err
 	}
-
-	programme := newProgramme(channelID)
-
-	// Handle start and end times
-	startTime, ok := safeGetString(eventData, "startTime")
-	if !ok {
-		return Programme{}, fmt.Errorf("invalid or missing startTime")
+	includedChannelIDs := make([]string, 0, len(channels))
+	for _, channel := range channels {
+		if !z.filters.IncludesChannel(channel) {
+			continue
+		}
+		if err := writer.WriteChannel(channel); err != nil {
+			writer.Abort()
+			return err
+		}
+		includedChannelIDs = append(includedChannelIDs, channel.ID)
 	}
-	programme.Start = z.BuildXMLDate(startTime)
+	z.filters.SetIncludedChannels(includedChannelIDs)
 
-	endTime, ok := safeGetString(eventData, "endTime")
-	if !ok {
-		return Programme{}, fmt.Errorf("invalid or missing endTime")
+	startTime, endTime := z.GetGuideTimes()
+	var windows []guideWindow
+	for t := startTime; t < endTime; t += 60 * 60 * 3 {
+		windows = append(windows, guideWindow{Start: t, End: t + 60*60*3})
 	}
-	programme.Stop = z.BuildXMLDate(endTime)
 
-	// Extract program data
-	programData, ok := safeGetMap(eventData, "program")
-	if !ok {
-		return Programme{}, fmt.Errorf("invalid or missing program data")
+	if err := z.fetchAndWriteProgrammeWindows(ctx, windows, writer); err != nil {
+		writer.Abort()
+		return err
 	}
 
-	// Set title
-	title, ok := safeGetString(programData, "title")
-	if !ok {
-		return Programme{}, fmt.Errorf("invalid or missing title")
+	if err := writer.Close(); err != nil {
+		return err
 	}
-	programme.Title = []Title{{Lang: z.lang, Text: title}}
 
-	// Set episode title if available
-	if episodeTitle, ok := safeGetString(programData, "episodeTitle"); ok && episodeTitle != "" {
-		programme.SubTitle = &SubTitle{Lang: z.lang, Text: episodeTitle}
+	if err := z.CopyHistorical(); err != nil {
+		return err
 	}
-
-	// Set description
-	shortDesc, ok := safeGetString(programData, "shortDesc")
-	if !ok || shortDesc == "" {
-		shortDesc = "Unavailable"
+	if err := z.CleanHistorical(); err != nil {
+		return err
 	}
-	programme.Desc = &Desc{Lang: z.lang, Text: shortDesc}
-
-	return programme, nil
-}
 
-func (z *Zap) BuildXMLDate(inTime string) string {
-	output := strings.ReplaceAll(inTime, "-", "")
-	output = strings.ReplaceAll(output, "T", "")
-	output = strings.ReplaceAll(output, ":", "")
-	output = strings.Replace(output, "Z", " +0000", 1)
-	return output
+	return nil
 }
 
-func (z *Zap) WriteGuide() error {
-	outputFile, err := os.Create(z.outputFile)
-	if err != nil {
-		return err
-	}
-	defer outputFile.Close()
-
-	encoder := xml.NewEncoder(outputFile)
-	encoder.Indent("", "  ")
-	if err := encoder.Encode(z.guideXML); err != nil {
-		return err
+// windowResult carries one guideWindow's fetch outcome back to
+// fetchAndWriteProgrammeWindows, tagged with its position in windows so
+// out-of-order completions can be held until it's their turn to write.
+type windowResult struct {
+	index      int
+	programmes []Programme
+	err        error
+}
+
+// fetchAndWriteProgrammeWindows fetches each guide window's programmes
+// through a bounded worker pool (sized by [prefs] fetchConcurrency), sharing
+// z.limiter across workers via whichever provider is configured, and streams
+// each window's programmes to writer as soon as every earlier window has
+// already been written. Unlike gathering every window into memory first,
+// at most fetchConcurrency windows' worth of programmes are ever held at
+// once, so peak heap stays bounded regardless of how long the guide spans.
+func (z *Zap) fetchAndWriteProgrammeWindows(ctx context.Context, windows []guideWindow, writer *guideWriter) error {
+	concurrency := z.config.Section("prefs").Key("fetchConcurrency").MustInt(4)
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	if concurrency > len(windows) {
+		concurrency = len(windows)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	resultCh := make(chan windowResult, concurrency)
+	var wg sync.WaitGroup
+	go func() {
+		sem := make(chan struct{}, concurrency)
+		for i, window := range windows {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(i int, window guideWindow) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				programmes, err := z.provider.Programmes(ctx, window)
+				resultCh <- windowResult{index: i, programmes: programmes, err: err}
+			}(i, window)
+		}
+		wg.Wait()
+		close(resultCh)
+	}()
+
+	pending := map[int][]Programme{}
+	next := 0
+	var firstErr error
+	for res := range resultCh {
+		if res.err != nil {
+			if firstErr == nil {
+				firstErr = res.err
+				cancel()
+			}
+			continue
+		}
+		if firstErr != nil {
+			continue
+		}
+		pending[res.index] = res.programmes
+		for {
+			programmes, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+			for _, programme := range programmes {
+				if !z.filters.IncludesProgramme(programme) {
+					continue
+				}
+				if err := writer.WriteProgramme(programme); err != nil {
+					firstErr = err
+					cancel()
+					break
+				}
+			}
+		}
 	}
+	return firstErr
+}
 
-	return nil
+func (z *Zap) GetGuideTimes() (int64, int64) {
+	currentTimestamp := time.Now().Unix()
+	currentTimestamp -= 60 * 60 * 24
+	halfHourOffset := currentTimestamp % (60 * 30)
+	currentTimestamp -= halfHourOffset
+	endTimestamp := currentTimestamp + (60 * 60 * 336)
+	return currentTimestamp, endTimestamp
 }
 
 func (z *Zap) CopyHistorical() error {
@@ -548,27 +457,67 @@ func (z *Zap) CleanHistorical() error {
 	return nil
 }
 
-func parseFlags() (configFile, guideFile, language string, findID bool) {
-	pflag.StringVarP(&configFile, "configfile", "c", "./zap2itconfig.ini", "Path to config file")
-	pflag.StringVarP(&guideFile, "outputfile", "o", "xmlguide.xmltv", "Path to output file")
-	pflag.StringVarP(&language, "language", "l", "en", "Language")
-	pflag.BoolVarP(&findID, "findid", "f", false, "Find Headendid / lineupid")
+type flags struct {
+	configFile       string
+	guideFile        string
+	language         string
+	findID           bool
+	forceRefresh     bool
+	includeChannel   []string
+	excludeChannel   []string
+	excludeProgramme []string
+}
+
+func parseFlags() flags {
+	var f flags
+	pflag.StringVarP(&f.configFile, "configfile", "c", "./zap2itconfig.ini", "Path to config file")
+	pflag.StringVarP(&f.guideFile, "outputfile", "o", "xmlguide.xmltv", "Path to output file")
+	pflag.StringVarP(&f.language, "language", "l", "en", "Preferred language (overrides [prefs] languages)")
+	pflag.BoolVarP(&f.findID, "findid", "f", false, "Find Headendid / lineupid (zap2it only)")
+	pflag.BoolVar(&f.forceRefresh, "force-refresh", false, "Bypass the on-disk cache and re-fetch every window")
+	pflag.StringArrayVar(&f.includeChannel, "include-channel", nil, `Channel include predicate, e.g. 'callSign =~ "^ESPN"' (repeatable, extends [filters] channelInclude)`)
+	pflag.StringArrayVar(&f.excludeChannel, "exclude-channel", nil, `Channel exclude predicate, e.g. 'channelNo in 900..999' (repeatable, extends [filters] channelExclude)`)
+	pflag.StringArrayVar(&f.excludeProgramme, "exclude-programme", nil, `Programme exclude predicate, e.g. 'category =~ "Infomercial"' (repeatable, extends [filters] programmeExclude)`)
 	pflag.Parse()
-	return
+	return f
 }
 
 func main() {
-	configFile, guideFile, language, findID := parseFlags()
+	f := parseFlags()
 
-	guide, err := GuideScrape(configFile, guideFile)
+	guide, err := GuideScrape(f.configFile, f.guideFile)
 	if err != nil {
 		log.Fatalf("Failed to initialize guide: %v", err)
 	}
 
-	guide.lang = language
+	if pflag.CommandLine.Changed("language") {
+		guide.langs = parseLanguages(f.language)
+	}
+	guide.forceRefresh = f.forceRefresh
+
+	for _, exprs := range []struct {
+		raw    []string
+		target *[]predicate
+	}{
+		{f.includeChannel, &guide.filters.channelInclude},
+		{f.excludeChannel, &guide.filters.channelExclude},
+		{f.excludeProgramme, &guide.filters.programmeExclude},
+	} {
+		for _, expr := range exprs.raw {
+			preds, err := parsePredicateList(expr)
+			if err != nil {
+				log.Fatalf("Invalid filter flag %q: %v", expr, err)
+			}
+			*exprs.target = append(*exprs.target, preds...)
+		}
+	}
 
-	if findID {
-		if err := guide.FindID(); err != nil {
+	if f.findID {
+		zp, ok := guide.provider.(*zap2itProvider)
+		if !ok {
+			log.Fatalf("--findid is only supported with [provider] type = zap2it")
+		}
+		if err := zp.FindID(); err != nil {
 			log.Fatalf("Failed to find ID: %v", err)
 		}
 		os.Exit(0)
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gopkg.in/ini.v1"
+)
+
+// fakeProvider is a Provider whose Programmes artificially reorders window
+// completion (later windows resolve before earlier ones) so tests can verify
+// fetchAndWriteProgrammeWindows buffers out-of-order results until it's their
+// turn to write, rather than writing them in completion order.
+type fakeProvider struct {
+	channels []Channel
+	// windowProgrammes maps a window's Start time to the programmes it
+	// should return, and windowDelay to how long to sleep before returning.
+	windowProgrammes map[int64][]Programme
+	windowDelay      map[int64]time.Duration
+}
+
+func (f *fakeProvider) Authenticate(ctx context.Context) error { return nil }
+
+func (f *fakeProvider) Channels(ctx context.Context) ([]Channel, error) {
+	return f.channels, nil
+}
+
+func (f *fakeProvider) Programmes(ctx context.Context, window guideWindow) ([]Programme, error) {
+	time.Sleep(f.windowDelay[window.Start])
+	return f.windowProgrammes[window.Start], nil
+}
+
+func TestFetchAndWriteProgrammeWindowsPreservesOrderAndAppliesFilters(t *testing.T) {
+	channels := []Channel{
+		{ID: "1", CallSign: "ESPN"},
+		{ID: "2", CallSign: "SHOPNOW"},
+	}
+	provider := &fakeProvider{
+		channels: channels,
+		windowProgrammes: map[int64][]Programme{
+			0:   {{Channel: "1", Start: "w0"}, {Channel: "2", Start: "w0-shop"}},
+			100: {{Channel: "1", Start: "w1"}},
+			200: {{Channel: "1", Start: "w2"}},
+		},
+		// The first window is the slowest to resolve, forcing windows 1 and 2
+		// to complete first and sit in the pending buffer.
+		windowDelay: map[int64]time.Duration{
+			0:   30 * time.Millisecond,
+			100: 10 * time.Millisecond,
+			200: 0,
+		},
+	}
+
+	fs := &filterSet{channelExclude: []predicate{mustPredicate(t, `callSign =~ "^SHOP"`)}}
+	var includedIDs []string
+	for _, c := range channels {
+		if fs.IncludesChannel(c) {
+			includedIDs = append(includedIDs, c.ID)
+		}
+	}
+	fs.SetIncludedChannels(includedIDs)
+
+	outputFile := filepath.Join(t.TempDir(), "guide.xmltv")
+	z := &Zap{
+		config:   ini.Empty(),
+		filters:  fs,
+		provider: provider,
+	}
+
+	writer, err := newGuideWriter(outputFile)
+	if err != nil {
+		t.Fatalf("newGuideWriter returned error: %v", err)
+	}
+	if err := writer.WriteHeader(Tv{}); err != nil {
+		t.Fatalf("WriteHeader returned error: %v", err)
+	}
+
+	windows := []guideWindow{{Start: 0}, {Start: 100}, {Start: 200}}
+	if err := z.fetchAndWriteProgrammeWindows(context.Background(), windows, writer); err != nil {
+		t.Fatalf("fetchAndWriteProgrammeWindows returned error: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("writer.Close returned error: %v", err)
+	}
+
+	raw, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("ReadFile returned error: %v", err)
+	}
+
+	var got struct {
+		Programmes []Programme `xml:"programme"`
+	}
+	if err := xml.Unmarshal(raw, &got); err != nil {
+		t.Fatalf("xml.Unmarshal returned error: %v", err)
+	}
+
+	var starts []string
+	for _, p := range got.Programmes {
+		starts = append(starts, p.Start)
+	}
+	want := []string{"w0", "w1", "w2"}
+	if len(starts) != len(want) {
+		t.Fatalf("wrote %d programmes %v, want %v (window 0's SHOPNOW programme should be filtered out)", len(starts), starts, want)
+	}
+	for i := range want {
+		if starts[i] != want[i] {
+			t.Errorf("programme %d = %q, want %q (windows should be written in window order, not completion order)", i, starts[i], want[i])
+		}
+	}
+}
+
+func TestResolveLanguagePrefersPreferredOrder(t *testing.T) {
+	available := map[string]string{"en": "English text", "es": "Texto en español"}
+	lang, text := ResolveLanguage([]string{"es", "en"}, available)
+	if lang != "es" || text != "Texto en español" {
+		t.Errorf("ResolveLanguage = (%q, %q), want (es, Texto en español)", lang, text)
+	}
+}
+
+func TestResolveLanguageFallsBackToEnglish(t *testing.T) {
+	available := map[string]string{"en": "English text", "fr": "Texte français"}
+	lang, text := ResolveLanguage([]string{"es", "de"}, available)
+	if lang != "en" || text != "English text" {
+		t.Errorf("ResolveLanguage = (%q, %q), want (en, English text)", lang, text)
+	}
+}
+
+func TestResolveLanguageFallsBackToAnyAvailable(t *testing.T) {
+	available := map[string]string{"fr": "Texte français"}
+	lang, text := ResolveLanguage([]string{"es", "de"}, available)
+	if lang != "fr" || text != "Texte français" {
+		t.Errorf("ResolveLanguage = (%q, %q), want (fr, Texte français)", lang, text)
+	}
+}
+
+func TestResolveLanguageEmptyAvailable(t *testing.T) {
+	lang, text := ResolveLanguage([]string{"es"}, map[string]string{})
+	if lang != "" || text != "" {
+		t.Errorf("ResolveLanguage = (%q, %q), want empty strings", lang, text)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// guideWindow is a half-open time range [Start, End) a Provider is asked to
+// return programmes for, in Unix seconds. zap2it and Schedules Direct fetch
+// one window at a time against their respective APIs; HDHomeRun pulls its
+// whole guide in a single call and slices it per window instead.
+type guideWindow struct {
+	Start int64
+	End   int64
+}
+
+// Provider is the seam between zap2itXMLTV's guide assembly and a specific
+// listings backend. zap2it's grid API used to be the only thing this tool
+// spoke to; pulling that scraping logic behind Provider lets [provider]
+// type pick Schedules Direct (a paid service many cord-cutters already
+// have, with richer credits and artwork) or an HDHomeRun tuner's own
+// guide instead, without BuildGuide knowing which one it's talking to.
+type Provider interface {
+	// Authenticate performs whatever login/handshake the backend requires
+	// before Channels or Programmes can be called.
+	Authenticate(ctx context.Context) error
+	// Channels returns the full channel lineup.
+	Channels(ctx context.Context) ([]Channel, error)
+	// Programmes returns the programmes airing on any channel during window.
+	Programmes(ctx context.Context, window guideWindow) ([]Programme, error)
+}
+
+// newProvider selects and constructs the Provider named by [provider] type,
+// defaulting to zap2it so configs written before this option still work.
+// It also stamps z's <tv> header metadata, since that varies by backend.
+func newProvider(z *Zap) (Provider, error) {
+	providerType := strings.ToLower(z.config.Section("provider").Key("type").MustString("zap2it"))
+	switch providerType {
+	case "", "zap2it":
+		z.sourceInfoName = "zap2it"
+		z.sourceInfoURL = "http://tvlistings.zap2it.com/"
+		return &zap2itProvider{z: z}, nil
+	case "schedulesdirect":
+		z.sourceInfoName = "Schedules Direct"
+		z.sourceInfoURL = "https://www.schedulesdirect.org/"
+		return &schedulesDirectProvider{z: z}, nil
+	case "hdhomerun":
+		z.sourceInfoName = "HDHomeRun"
+		z.sourceInfoURL = "https://www.silicondust.com/"
+		return &hdHomeRunProvider{z: z}, nil
+	default:
+		return nil, fmt.Errorf("unknown [provider] type %q, want zap2it, schedulesdirect or hdhomerun", providerType)
+	}
+}
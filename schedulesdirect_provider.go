@@ -0,0 +1,588 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// schedulesDirectBaseURL is Schedules Direct's stable JSON API root.
+const schedulesDirectBaseURL = "https://json.schedulesdirect.org/20141201"
+
+// schedulesDirectImageBaseURL is prefixed onto the relative "uri" values
+// returned by the metadata/programs artwork endpoint.
+const schedulesDirectImageBaseURL = "https://json.schedulesdirect.org/20141201/image/"
+
+// schedulesDirectProvider implements Provider against Schedules Direct's
+// JSON listings API, a paid service many cord-cutters already subscribe to
+// for a lineup they configured once on schedulesdirect.org. Station/program
+// metadata comes back far richer than zap2it's (separate cast vs crew,
+// dedicated artwork lookups, structured content ratings), so BuildEventXML
+// can't be reused as-is.
+type schedulesDirectProvider struct {
+	z     *Zap
+	token string
+
+	stationsOnce     sync.Once
+	stationsErr      error
+	stations         []sdStation
+	stationChannelNo map[string]string
+
+	artworkMu    sync.Mutex
+	artworkCache map[string]string
+
+	// scheduleMu guards scheduleCache, an in-process memo of schedule
+	// results keyed by station ID and the dates requested, the same fix
+	// zap2itProvider.dataCache and hdHomeRunProvider.guideCache got:
+	// near-now windows always make cacheTTLFor return 0, so without this
+	// every window in the lineup's near-now period would re-fetch the
+	// same station+day live.
+	scheduleMu    sync.Mutex
+	scheduleCache map[string][]sdScheduleProgram
+}
+
+type sdTokenResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Token   string `json:"token"`
+}
+
+type sdStation struct {
+	StationID string `json:"stationID"`
+	Name      string `json:"name"`
+	Callsign  string `json:"callsign"`
+	Affiliate string `json:"affiliate"`
+	Logo      struct {
+		URL string `json:"URL"`
+	} `json:"logo"`
+}
+
+type sdLineupResponse struct {
+	Map []struct {
+		StationID string `json:"stationID"`
+		Channel   string `json:"channel"`
+	} `json:"map"`
+	Stations []sdStation `json:"stations"`
+}
+
+type sdScheduleRequest struct {
+	StationID string   `json:"stationID"`
+	Date      []string `json:"date"`
+}
+
+type sdScheduleProgram struct {
+	ProgramID   string `json:"programID"`
+	AirDateTime string `json:"airDateTime"`
+	Duration    int    `json:"duration"`
+}
+
+type sdStationSchedule struct {
+	StationID string              `json:"stationID"`
+	Programs  []sdScheduleProgram `json:"programs"`
+}
+
+type sdDescription struct {
+	DescriptionLanguage string `json:"descriptionLanguage"`
+	Description         string `json:"description"`
+}
+
+type sdPerson struct {
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+type sdContentRating struct {
+	Body string `json:"body"`
+	Code string `json:"code"`
+}
+
+type sdProgram struct {
+	ProgramID       string `json:"programID"`
+	EpisodeTitle150 string `json:"episodeTitle150"`
+	Titles          []struct {
+		Title120 string `json:"title120"`
+	} `json:"titles"`
+	Descriptions struct {
+		Description100  []sdDescription `json:"description100"`
+		Description1000 []sdDescription `json:"description1000"`
+	} `json:"descriptions"`
+	OriginalAirDate string            `json:"originalAirDate"`
+	Genres          []string          `json:"genres"`
+	ContentRating   []sdContentRating `json:"contentRating"`
+	Cast            []sdPerson        `json:"cast"`
+	Crew            []sdPerson        `json:"crew"`
+	HasImageArtwork bool              `json:"hasImageArtwork"`
+}
+
+func (p *schedulesDirectProvider) Authenticate(ctx context.Context) error {
+	username := p.z.config.Section("schedulesdirect").Key("username").String()
+	password := p.z.config.Section("schedulesdirect").Key("password").String()
+
+	hash := sha1.Sum([]byte(password))
+	body, err := json.Marshal(map[string]string{
+		"username": username,
+		"password": hex.EncodeToString(hash[:]),
+	})
+	if err != nil {
+		return err
+	}
+
+	bodyBytes, err := p.z.doWithRetry(ctx, func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", schedulesDirectBaseURL+"/token", bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	})
+	if err != nil {
+		return fmt.Errorf("error connecting to json.schedulesdirect.org: %v", err)
+	}
+
+	var tok sdTokenResponse
+	if err := json.Unmarshal(bodyBytes, &tok); err != nil {
+		return fmt.Errorf("error parsing JSON: %v", err)
+	}
+	if tok.Code != 0 {
+		return fmt.Errorf("schedules direct login failed: %s", tok.Message)
+	}
+	p.token = tok.Token
+	return nil
+}
+
+func (p *schedulesDirectProvider) get(ctx context.Context, path string) ([]byte, error) {
+	return p.z.doWithRetry(ctx, func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "GET", schedulesDirectBaseURL+path, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("token", p.token)
+		return req, nil
+	})
+}
+
+func (p *schedulesDirectProvider) post(ctx context.Context, path string, payload interface{}) ([]byte, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return p.z.doWithRetry(ctx, func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", schedulesDirectBaseURL+path, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("token", p.token)
+		return req, nil
+	})
+}
+
+// lineup lazily fetches and memoizes this account's configured lineup
+// station list. Both Channels and Programmes need it: Programmes has to
+// know which station IDs to request schedules for.
+func (p *schedulesDirectProvider) lineup(ctx context.Context) ([]sdStation, map[string]string, error) {
+	p.stationsOnce.Do(func() {
+		lineupID := p.z.config.Section("schedulesdirect").Key("lineupId").String()
+		bodyBytes, err := p.get(ctx, "/lineups/"+lineupID)
+		if err != nil {
+			p.stationsErr = fmt.Errorf("error fetching lineup %q: %v", lineupID, err)
+			return
+		}
+		var resp sdLineupResponse
+		if err := json.Unmarshal(bodyBytes, &resp); err != nil {
+			p.stationsErr = fmt.Errorf("error parsing JSON: %v", err)
+			return
+		}
+		p.stations = resp.Stations
+		p.stationChannelNo = make(map[string]string, len(resp.Map))
+		for _, m := range resp.Map {
+			p.stationChannelNo[m.StationID] = m.Channel
+		}
+	})
+	return p.stations, p.stationChannelNo, p.stationsErr
+}
+
+func (p *schedulesDirectProvider) Channels(ctx context.Context) ([]Channel, error) {
+	stations, channelNos, err := p.lineup(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var channels []Channel
+	for _, s := range stations {
+		channelNo := channelNos[s.StationID]
+		channel := Channel{
+			ID: s.StationID,
+			DisplayName: []string{
+				fmt.Sprintf("%s %s", channelNo, s.Callsign),
+				channelNo,
+				s.Callsign,
+				strings.Title(s.Affiliate),
+			},
+			CallSign:  s.Callsign,
+			ChannelNo: channelNo,
+			Affiliate: s.Affiliate,
+		}
+		if s.Logo.URL != "" {
+			channel.Icon = &Icon{Src: s.Logo.URL}
+		}
+		channels = append(channels, channel)
+	}
+	return channels, nil
+}
+
+// windowDates returns the UTC calendar dates (YYYY-MM-DD) a window spans,
+// since Schedules Direct's /schedules endpoint is keyed by date rather
+// than an arbitrary time range. A 3-hour window almost always spans one
+// date; it spans two only when it straddles midnight UTC.
+func windowDates(window guideWindow) []string {
+	start := time.Unix(window.Start, 0).UTC()
+	end := time.Unix(window.End, 0).UTC()
+	day := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+
+	var dates []string
+	for !day.After(end) {
+		dates = append(dates, day.Format("2006-01-02"))
+		day = day.AddDate(0, 0, 1)
+	}
+	return dates
+}
+
+// schedule fetches (or reuses a cached copy of) a station's airings for the
+// dates a window spans. Results are also memoized in-process per
+// station+dates for the lifetime of p, so near-now windows (which always
+// force cacheTTLFor's on-disk TTL to 0) don't re-fetch the same station+day
+// live once per window.
+func (p *schedulesDirectProvider) schedule(ctx context.Context, stationID string, window guideWindow) ([]sdScheduleProgram, error) {
+	dates := windowDates(window)
+	memoKey := stationID + "|" + strings.Join(dates, ",")
+
+	p.scheduleMu.Lock()
+	if programs, ok := p.scheduleCache[memoKey]; ok {
+		p.scheduleMu.Unlock()
+		return programs, nil
+	}
+	p.scheduleMu.Unlock()
+
+	cachePath := p.z.cachePath("schedulesdirect", stationID, strings.Join(dates, ","), 0)
+	ttl := p.z.cacheTTLFor(window.Start)
+
+	programs, err := func() ([]sdScheduleProgram, error) {
+		if cached, ok := p.z.readCache(cachePath, ttl); ok {
+			var schedules []sdStationSchedule
+			if err := json.Unmarshal(cached, &schedules); err == nil && len(schedules) > 0 {
+				return schedules[0].Programs, nil
+			}
+		}
+
+		p.z.limiter.Wait()
+		bodyBytes, err := p.post(ctx, "/schedules", []sdScheduleRequest{{StationID: stationID, Date: dates}})
+		if err != nil {
+			return nil, fmt.Errorf("error fetching schedule for station %s: %v", stationID, err)
+		}
+		if err := p.z.writeCache(cachePath, bodyBytes); err != nil {
+			fmt.Printf("warning: failed to write cache for station %s: %v\n", stationID, err)
+		}
+
+		var schedules []sdStationSchedule
+		if err := json.Unmarshal(bodyBytes, &schedules); err != nil {
+			return nil, fmt.Errorf("error parsing JSON: %v", err)
+		}
+		if len(schedules) == 0 {
+			return nil, nil
+		}
+		return schedules[0].Programs, nil
+	}()
+	if err != nil {
+		return nil, err
+	}
+
+	p.scheduleMu.Lock()
+	if p.scheduleCache == nil {
+		p.scheduleCache = map[string][]sdScheduleProgram{}
+	}
+	p.scheduleCache[memoKey] = programs
+	p.scheduleMu.Unlock()
+
+	return programs, nil
+}
+
+// programs fetches full metadata for a batch of program IDs in a single
+// request, as Schedules Direct's API expects.
+func (p *schedulesDirectProvider) programs(ctx context.Context, ids []string) (map[string]sdProgram, error) {
+	p.z.limiter.Wait()
+	bodyBytes, err := p.post(ctx, "/programs", ids)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching program details: %v", err)
+	}
+
+	var list []sdProgram
+	if err := json.Unmarshal(bodyBytes, &list); err != nil {
+		return nil, fmt.Errorf("error parsing JSON: %v", err)
+	}
+
+	byID := make(map[string]sdProgram, len(list))
+	for _, prog := range list {
+		byID[prog.ProgramID] = prog
+	}
+	return byID, nil
+}
+
+// parseArtworkURL extracts the preferred artwork URL from a
+// /metadata/programs/<id> response body, or "" if none was usable.
+func parseArtworkURL(bodyBytes []byte) string {
+	var resp []struct {
+		ProgramID string `json:"programID"`
+		Data      []struct {
+			URI string `json:"uri"`
+		} `json:"data"`
+	}
+	if json.Unmarshal(bodyBytes, &resp) != nil {
+		return ""
+	}
+	for _, r := range resp {
+		if len(r.Data) > 0 && r.Data[0].URI != "" {
+			return schedulesDirectImageBaseURL + r.Data[0].URI
+		}
+	}
+	return ""
+}
+
+// artwork looks up a program's preferred piece of artwork, memoized across
+// the run since the same movie/series airs on many stations, and cached to
+// disk like schedule/programs since artwork rarely changes once published.
+func (p *schedulesDirectProvider) artwork(ctx context.Context, programID string) string {
+	p.artworkMu.Lock()
+	if p.artworkCache == nil {
+		p.artworkCache = map[string]string{}
+	}
+	if url, ok := p.artworkCache[programID]; ok {
+		p.artworkMu.Unlock()
+		return url
+	}
+	p.artworkMu.Unlock()
+
+	cachePath := p.z.cachePath("schedulesdirect-artwork", programID, "", 0)
+
+	var url string
+	if cached, ok := p.z.readCache(cachePath, p.z.cacheTTL); ok {
+		url = parseArtworkURL(cached)
+	} else {
+		p.z.limiter.Wait()
+		bodyBytes, err := p.get(ctx, "/metadata/programs/"+programID)
+		if err == nil {
+			url = parseArtworkURL(bodyBytes)
+			if err := p.z.writeCache(cachePath, bodyBytes); err != nil {
+				fmt.Printf("warning: failed to write cache for program %s artwork: %v\n", programID, err)
+			}
+		}
+	}
+
+	p.artworkMu.Lock()
+	p.artworkCache[programID] = url
+	p.artworkMu.Unlock()
+	return url
+}
+
+// Programmes fetches every lineup station's schedule for the dates window
+// spans, then batch-fetches program metadata for every airing that starts
+// inside the window. Airings are assigned to exactly one window by start
+// time so a show straddling a window boundary isn't emitted twice.
+func (p *schedulesDirectProvider) Programmes(ctx context.Context, window guideWindow) ([]Programme, error) {
+	stations, _, err := p.lineup(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	type airing struct {
+		stationID string
+		programID string
+		start     int64
+		stop      int64
+	}
+
+	var airings []airing
+	programIDSet := map[string]bool{}
+	for _, station := range stations {
+		schedule, err := p.schedule(ctx, station.StationID, window)
+		if err != nil {
+			return nil, err
+		}
+		for _, sp := range schedule {
+			airTime, err := time.Parse(time.RFC3339, sp.AirDateTime)
+			if err != nil {
+				continue
+			}
+			start := airTime.Unix()
+			stop := start + int64(sp.Duration)
+			if start < window.Start || start >= window.End {
+				continue
+			}
+			airings = append(airings, airing{stationID: station.StationID, programID: sp.ProgramID, start: start, stop: stop})
+			programIDSet[sp.ProgramID] = true
+		}
+	}
+
+	if len(airings) == 0 {
+		return nil, nil
+	}
+
+	programIDs := make([]string, 0, len(programIDSet))
+	for id := range programIDSet {
+		programIDs = append(programIDs, id)
+	}
+	programs, err := p.programs(ctx, programIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	var programmes []Programme
+	for _, a := range airings {
+		program, ok := programs[a.programID]
+		if !ok {
+			continue
+		}
+		programmes = append(programmes, p.buildProgramme(ctx, a.stationID, a.start, a.stop, program))
+	}
+	return programmes, nil
+}
+
+func (p *schedulesDirectProvider) buildProgramme(ctx context.Context, stationID string, start, stop int64, program sdProgram) Programme {
+	// SD's title/episode-title/genre fields don't carry their own language
+	// tag the way descriptions do, but a single program record comes back
+	// in one locale, so the language resolved from its descriptions (or
+	// this guide's first preference if it has none) is reused for them too.
+	descriptions := sdDescriptionsByLang(program.Descriptions.Description1000, program.Descriptions.Description100)
+	lang, _ := ResolveLanguage(p.z.langs, descriptions)
+	if lang == "" {
+		lang = p.z.langs[0]
+	}
+
+	programme := Programme{
+		Channel: stationID,
+		Start:   sdBuildXMLDate(start),
+		Stop:    sdBuildXMLDate(stop),
+	}
+
+	title := ""
+	if len(program.Titles) > 0 {
+		title = program.Titles[0].Title120
+	}
+	programme.Title = []Title{{Lang: lang, Text: title}}
+
+	if program.EpisodeTitle150 != "" {
+		programme.SubTitle = []SubTitle{{Lang: lang, Text: program.EpisodeTitle150}}
+	}
+
+	for _, l := range p.z.selectLanguages(descriptions) {
+		programme.Desc = append(programme.Desc, Desc{Lang: l, Text: descriptions[l]})
+	}
+
+	programme.Categories = sdBuildCategories(program.Genres, lang)
+	programme.Credits = sdBuildCredits(program.Cast, program.Crew)
+	programme.Date = sdBuildDate(program.OriginalAirDate)
+	programme.Rating = sdBuildRating(program.ContentRating)
+
+	if program.HasImageArtwork {
+		if url := p.artwork(ctx, program.ProgramID); url != "" {
+			programme.Icon = &Icon{Src: url}
+		}
+	}
+
+	return programme
+}
+
+// sdDescriptionsByLang groups a program's long and short descriptions by
+// DescriptionLanguage, preferring the long-form synopsis over the short one
+// within a language, so callers can run the same language selection
+// zap2itProvider's buildDescs applies to its localized alternatives.
+func sdDescriptionsByLang(long, short []sdDescription) map[string]string {
+	available := map[string]string{}
+	for _, d := range short {
+		if d.Description != "" && d.DescriptionLanguage != "" {
+			available[d.DescriptionLanguage] = d.Description
+		}
+	}
+	for _, d := range long {
+		if d.Description != "" && d.DescriptionLanguage != "" {
+			available[d.DescriptionLanguage] = d.Description
+		}
+	}
+	return available
+}
+
+func sdBuildCategories(genres []string, lang string) []Category {
+	var categories []Category
+	for _, g := range genres {
+		if g == "" {
+			continue
+		}
+		categories = append(categories, Category{Lang: lang, Text: g})
+	}
+	return categories
+}
+
+// sdBuildCredits maps Schedules Direct's separate cast and crew lists onto
+// <credits>, which is the richer split zap2it's single topCast list can't
+// express (SD already tells us who directed vs who produced vs who acted).
+func sdBuildCredits(cast, crew []sdPerson) *Credits {
+	if len(cast) == 0 && len(crew) == 0 {
+		return nil
+	}
+
+	credits := &Credits{}
+	for _, c := range crew {
+		switch strings.ToLower(c.Role) {
+		case "director":
+			credits.Director = append(credits.Director, c.Name)
+		case "writer":
+			credits.Writer = append(credits.Writer, c.Name)
+		case "producer", "executive producer":
+			credits.Producer = append(credits.Producer, c.Name)
+		default:
+			credits.Guest = append(credits.Guest, c.Name)
+		}
+	}
+	for _, c := range cast {
+		credits.Actor = append(credits.Actor, Actor{Role: c.Role, Text: c.Name})
+	}
+
+	if len(credits.Director) == 0 && len(credits.Actor) == 0 && len(credits.Writer) == 0 &&
+		len(credits.Producer) == 0 && len(credits.Guest) == 0 {
+		return nil
+	}
+	return credits
+}
+
+// sdBuildDate converts Schedules Direct's YYYY-MM-DD originalAirDate into
+// the digits-only form XMLTV's <date> expects.
+func sdBuildDate(originalAirDate string) *Date {
+	if originalAirDate == "" {
+		return nil
+	}
+	return &Date{Text: strings.ReplaceAll(originalAirDate, "-", "")}
+}
+
+// sdBuildRating uses the first content rating Schedules Direct returns,
+// tagging it with the rating body (e.g. "USA Parental Rating") as the
+// XMLTV rating system.
+func sdBuildRating(ratings []sdContentRating) *Rating {
+	for _, r := range ratings {
+		if r.Code == "" {
+			continue
+		}
+		return &Rating{System: r.Body, Value: &Value{Text: r.Code}}
+	}
+	return nil
+}
+
+func sdBuildXMLDate(unixSeconds int64) string {
+	return time.Unix(unixSeconds, 0).UTC().Format("20060102150405 -0700")
+}
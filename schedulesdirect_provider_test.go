@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// rewriteTransport redirects every outbound request to target, preserving
+// path and method, so code hardcoded against schedulesDirectBaseURL can be
+// pointed at an httptest.Server.
+type rewriteTransport struct {
+	target *url.URL
+}
+
+func (t *rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = t.target.Scheme
+	req.URL.Host = t.target.Host
+	req.Host = t.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func newTestZap(t *testing.T, handler http.Handler) *Zap {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	target, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("failed to parse test server URL: %v", err)
+	}
+	return &Zap{
+		httpClient: &http.Client{Transport: &rewriteTransport{target: target}},
+		limiter:    newRateLimiter(1000),
+		cacheDir:   t.TempDir(),
+		cacheTTL:   time.Hour,
+	}
+}
+
+func TestWindowDatesWithinOneDay(t *testing.T) {
+	start := time.Date(2026, 3, 5, 20, 0, 0, 0, time.UTC)
+	window := guideWindow{Start: start.Unix(), End: start.Add(3 * time.Hour).Unix()}
+
+	dates := windowDates(window)
+	if want := []string{"2026-03-05"}; !reflect.DeepEqual(dates, want) {
+		t.Errorf("windowDates(%v) = %v, want %v", window, dates, want)
+	}
+}
+
+func TestWindowDatesStraddlingMidnightUTCReturnsBothDays(t *testing.T) {
+	start := time.Date(2026, 3, 5, 23, 30, 0, 0, time.UTC)
+	window := guideWindow{Start: start.Unix(), End: start.Add(3 * time.Hour).Unix()}
+
+	dates := windowDates(window)
+	if want := []string{"2026-03-05", "2026-03-06"}; !reflect.DeepEqual(dates, want) {
+		t.Errorf("windowDates(%v) = %v, want %v (window spans both calendar days)", window, dates, want)
+	}
+}
+
+func TestBuildProgrammeTagsDescriptionByItsOwnLanguage(t *testing.T) {
+	z := &Zap{langs: []string{"es", "en"}}
+	p := &schedulesDirectProvider{z: z}
+
+	program := sdProgram{
+		Titles: []struct {
+			Title120 string `json:"title120"`
+		}{{Title120: "El Programa"}},
+		Descriptions: struct {
+			Description100  []sdDescription `json:"description100"`
+			Description1000 []sdDescription `json:"description1000"`
+		}{
+			Description1000: []sdDescription{
+				{DescriptionLanguage: "en", Description: "The long English synopsis."},
+				{DescriptionLanguage: "es", Description: "La sinopsis larga en español."},
+			},
+		},
+	}
+
+	programme := p.buildProgramme(context.Background(), "10.1", 0, 1800, program)
+
+	if len(programme.Desc) != 2 {
+		t.Fatalf("Desc = %+v, want one entry per available description language", programme.Desc)
+	}
+	descByLang := map[string]string{}
+	for _, d := range programme.Desc {
+		descByLang[d.Lang] = d.Text
+	}
+	if descByLang["es"] != "La sinopsis larga en español." {
+		t.Errorf("es Desc = %q, want the Spanish synopsis, not a mismatched language tag", descByLang["es"])
+	}
+	if descByLang["en"] != "The long English synopsis." {
+		t.Errorf("en Desc = %q, want the English synopsis", descByLang["en"])
+	}
+
+	// Title has no per-language data of its own, so it's tagged with the
+	// language resolved from the descriptions (the guide's first available
+	// preference), not silently mislabeled as some other language.
+	if len(programme.Title) != 1 || programme.Title[0].Lang != "es" {
+		t.Errorf("Title = %+v, want a single title tagged lang=es", programme.Title)
+	}
+}
+
+func TestBuildProgrammeFallsBackToFirstPreferredLanguageWithoutDescriptions(t *testing.T) {
+	z := &Zap{langs: []string{"fr", "en"}}
+	p := &schedulesDirectProvider{z: z}
+
+	programme := p.buildProgramme(context.Background(), "10.1", 0, 1800, sdProgram{
+		Titles: []struct {
+			Title120 string `json:"title120"`
+		}{{Title120: "Le Programme"}},
+	})
+
+	if len(programme.Title) != 1 || programme.Title[0].Lang != "fr" {
+		t.Errorf("Title = %+v, want a single title tagged lang=fr (this guide's first preference)", programme.Title)
+	}
+	if programme.Desc != nil {
+		t.Errorf("Desc = %+v, want nil with no descriptions available", programme.Desc)
+	}
+}
+
+func TestArtworkCachesToDiskAcrossProviderInstances(t *testing.T) {
+	var hits int32
+	z := newTestZap(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Write([]byte(`[{"programID":"EP123","data":[{"uri":"p123.jpg"}]}]`))
+	}))
+	ctx := context.Background()
+
+	p1 := &schedulesDirectProvider{z: z, token: "tok"}
+	url1 := p1.artwork(ctx, "EP123")
+	if url1 == "" {
+		t.Fatal("expected a non-empty artwork URL")
+	}
+
+	// A fresh provider instance has no in-process artworkCache, so this
+	// only avoids a second live fetch if the on-disk cache is actually
+	// being used.
+	p2 := &schedulesDirectProvider{z: z, token: "tok"}
+	url2 := p2.artwork(ctx, "EP123")
+	if url2 != url1 {
+		t.Errorf("artwork URL changed across provider instances: %q vs %q", url1, url2)
+	}
+
+	if got := atomic.LoadInt32(&hits); got != 1 {
+		t.Errorf("metadata endpoint was hit %d times, want 1 (second lookup should have used the on-disk cache)", got)
+	}
+}
+
+func TestArtworkGoesThroughTheRateLimiter(t *testing.T) {
+	z := newTestZap(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"programID":"x","data":[{"uri":"x.jpg"}]}]`))
+	}))
+	// Burst capacity of 2, refilling at 5/sec: the first two distinct
+	// lookups drain the bucket instantly, so the third must wait ~200ms.
+	z.limiter = newRateLimiter(5)
+	z.limiter.tokens = 2
+	z.limiter.max = 2
+
+	p := &schedulesDirectProvider{z: z, token: "tok"}
+	ctx := context.Background()
+
+	p.artwork(ctx, "prog-1")
+	p.artwork(ctx, "prog-2")
+
+	start := time.Now()
+	p.artwork(ctx, "prog-3")
+	elapsed := time.Since(start)
+
+	if elapsed < 100*time.Millisecond {
+		t.Errorf("artwork for prog-3 returned after %v, want it to have waited on the rate limiter (~200ms)", elapsed)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/xml"
+	"os"
+)
+
+// guideWriter streams a Tv document to disk one <channel>/<programme> at a
+// time instead of buffering the whole guide in memory first. For a 336-hour
+// guide across a large cable lineup that keeps peak heap at a few MB instead
+// of hundreds. It writes to a ".tmp" sibling of the final path and only
+// renames it into place once Close succeeds, so a process killed mid-run
+// leaves the last good guide untouched instead of a truncated one.
+type guideWriter struct {
+	finalPath string
+	tmpPath   string
+	file      *os.File
+	enc       *xml.Encoder
+}
+
+// newGuideWriter creates outputFile.tmp and prepares an encoder to stream
+// into it.
+func newGuideWriter(outputFile string) (*guideWriter, error) {
+	tmpPath := outputFile + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return nil, err
+	}
+	enc := xml.NewEncoder(file)
+	enc.Indent("", "  ")
+	return &guideWriter{finalPath: outputFile, tmpPath: tmpPath, file: file, enc: enc}, nil
+}
+
+// WriteHeader emits the XML declaration and the opening <tv> element. Only
+// the attributes of tv are used; any Channels/Programmes are ignored since
+// those stream in separately via WriteChannel/WriteProgramme.
+func (w *guideWriter) WriteHeader(tv Tv) error {
+	if _, err := w.file.WriteString(xml.Header); err != nil {
+		return err
+	}
+	start := xml.StartElement{
+		Name: xml.Name{Local: "tv"},
+		Attr: []xml.Attr{
+			{Name: xml.Name{Local: "source-info-url"}, Value: tv.SourceInfoURL},
+			{Name: xml.Name{Local: "source-info-name"}, Value: tv.SourceInfoName},
+			{Name: xml.Name{Local: "generator-info-name"}, Value: tv.GeneratorInfoName},
+			{Name: xml.Name{Local: "generator-info-url"}, Value: tv.GeneratorInfoURL},
+		},
+	}
+	return w.enc.EncodeToken(start)
+}
+
+// WriteChannel streams a single <channel> element to disk.
+func (w *guideWriter) WriteChannel(c Channel) error {
+	return w.enc.Encode(c)
+}
+
+// WriteProgramme streams a single <programme> element to disk.
+func (w *guideWriter) WriteProgramme(p Programme) error {
+	return w.enc.Encode(p)
+}
+
+// Close emits the closing </tv> element, flushes the encoder, and atomically
+// renames the temp file onto the final output path.
+func (w *guideWriter) Close() error {
+	end := xml.EndElement{Name: xml.Name{Local: "tv"}}
+	if err := w.enc.EncodeToken(end); err != nil {
+		w.file.Close()
+		return err
+	}
+	if err := w.enc.Flush(); err != nil {
+		w.file.Close()
+		return err
+	}
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(w.tmpPath, w.finalPath)
+}
+
+// Abort discards the in-progress temp file without touching the final
+// output path, leaving any previously written guide in place.
+func (w *guideWriter) Abort() {
+	w.file.Close()
+	os.Remove(w.tmpPath)
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestGuideWriterRoundTripsEveryXMLTVElement builds a Channel and a Programme
+// that populate every optional XMLTV sub-element zap2itXMLTV knows how to
+// emit, writes them through guideWriter, and checks the result both parses
+// back into the original values and contains every element tag verbatim —
+// so a regression that silently drops a field (e.g. a bad omitempty) shows
+// up as a failing assertion instead of quietly shrinking the output.
+func TestGuideWriterRoundTripsEveryXMLTVElement(t *testing.T) {
+	channel := Channel{
+		ID:          "I12345.zap2it.com",
+		DisplayName: []string{"5 ESPN", "ESPN"},
+		Icon:        &Icon{Src: "http://example.com/espn.png"},
+	}
+
+	programme := Programme{
+		Start:   "20260728120000 +0000",
+		Stop:    "20260728123000 +0000",
+		Channel: channel.ID,
+		Title:   []Title{{Lang: "en", Text: "SportsCenter"}},
+		SubTitle: []SubTitle{
+			{Lang: "en", Text: "Top Plays"},
+		},
+		Desc: []Desc{
+			{Lang: "en", Text: "Highlights from around the league."},
+		},
+		Credits: &Credits{
+			Director: []string{"Jane Director"},
+			Actor:    []Actor{{Role: "Host", Text: "John Host"}},
+			Writer:   []string{"Writer One"},
+			Producer: []string{"Producer One"},
+			Guest:    []string{"Guest One"},
+		},
+		Date:   &Date{Text: "20260101"},
+		Length: &Length{Units: "minutes", Text: "30"},
+		Icon:   &Icon{Src: "http://example.com/sc.png"},
+		URL:    &URL{Text: "http://example.com/sc"},
+		Categories: []Category{
+			{Lang: "en", Text: "Sports"},
+		},
+		EpisodeNums: []EpisodeNum{
+			{System: "xmltv_ns", Text: "0.0.0/1"},
+		},
+		Video: &Video{Quality: "HDTV"},
+		Audio: &Audio{Stereo: "stereo"},
+		New:   &struct{}{},
+		Subtitles: &Subtitles{
+			Type: "teletext",
+		},
+		Rating: &Rating{
+			System: "VCHIP",
+			Value:  &Value{Text: "TV-PG"},
+		},
+		StarRating: &StarRating{
+			Value: &Value{Text: "7/10"},
+		},
+	}
+
+	outputFile := filepath.Join(t.TempDir(), "guide.xmltv")
+	w, err := newGuideWriter(outputFile)
+	if err != nil {
+		t.Fatalf("newGuideWriter returned error: %v", err)
+	}
+	if err := w.WriteHeader(Tv{
+		SourceInfoURL:     "http://example.com/",
+		SourceInfoName:    "example",
+		GeneratorInfoName: "zap2itXMLTV",
+		GeneratorInfoURL:  "https://github.com/spf13/zap2itxmltv",
+	}); err != nil {
+		t.Fatalf("WriteHeader returned error: %v", err)
+	}
+	if err := w.WriteChannel(channel); err != nil {
+		t.Fatalf("WriteChannel returned error: %v", err)
+	}
+	if err := w.WriteProgramme(programme); err != nil {
+		t.Fatalf("WriteProgramme returned error: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+
+	raw, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("ReadFile returned error: %v", err)
+	}
+	out := string(raw)
+
+	for _, tag := range []string{
+		"<tv ", "<channel", "<display-name", "<icon", "<programme",
+		"<title", "<sub-title", "<desc", "<credits", "<director",
+		"<actor", "<writer", "<producer", "<guest", "<date", "<length",
+		"<url", "<category", "<episode-num", "<video", "<audio",
+		"<new", "<subtitles", "<rating", "<value", "<star-rating",
+	} {
+		if !strings.Contains(out, tag) {
+			t.Errorf("output is missing %q element; got:\n%s", tag, out)
+		}
+	}
+
+	var doc struct {
+		XMLName   xml.Name  `xml:"tv"`
+		Channel   Channel   `xml:"channel"`
+		Programme Programme `xml:"programme"`
+	}
+	if err := xml.Unmarshal(raw, &doc); err != nil {
+		t.Fatalf("xml.Unmarshal returned error: %v", err)
+	}
+
+	if len(doc.Channel.DisplayName) != 2 {
+		t.Errorf("Channel.DisplayName = %v, want 2 entries", doc.Channel.DisplayName)
+	}
+	if doc.Channel.Icon == nil || doc.Channel.Icon.Src != channel.Icon.Src {
+		t.Errorf("Channel.Icon = %+v, want %+v", doc.Channel.Icon, channel.Icon)
+	}
+
+	got := doc.Programme
+	if got.Start != programme.Start || got.Stop != programme.Stop || got.Channel != programme.Channel {
+		t.Errorf("Programme start/stop/channel = %q/%q/%q, want %q/%q/%q", got.Start, got.Stop, got.Channel, programme.Start, programme.Stop, programme.Channel)
+	}
+	if len(got.Title) != 1 || got.Title[0].Text != "SportsCenter" {
+		t.Errorf("Programme.Title = %+v, want SportsCenter", got.Title)
+	}
+	if got.Credits == nil || len(got.Credits.Actor) != 1 || got.Credits.Actor[0].Text != "John Host" {
+		t.Errorf("Programme.Credits = %+v, want an actor named John Host", got.Credits)
+	}
+	if got.Rating == nil || got.Rating.Value == nil || got.Rating.Value.Text != "TV-PG" {
+		t.Errorf("Programme.Rating = %+v, want value TV-PG", got.Rating)
+	}
+	if got.StarRating == nil || got.StarRating.Value == nil || got.StarRating.Value.Text != "7/10" {
+		t.Errorf("Programme.StarRating = %+v, want value 7/10", got.StarRating)
+	}
+	if got.New == nil {
+		t.Error("Programme.New = nil, want non-nil (new element should round-trip)")
+	}
+}
+
+// TestGuideWriterOmitsEmptyOptionalElements checks the flip side of the
+// round-trip test above: a Programme with none of its optional fields set
+// shouldn't emit any of their XML tags, keeping slim guides actually slim.
+func TestGuideWriterOmitsEmptyOptionalElements(t *testing.T) {
+	outputFile := filepath.Join(t.TempDir(), "guide.xmltv")
+	w, err := newGuideWriter(outputFile)
+	if err != nil {
+		t.Fatalf("newGuideWriter returned error: %v", err)
+	}
+	if err := w.WriteHeader(Tv{}); err != nil {
+		t.Fatalf("WriteHeader returned error: %v", err)
+	}
+	if err := w.WriteProgramme(Programme{
+		Start:   "20260728120000 +0000",
+		Stop:    "20260728123000 +0000",
+		Channel: "I12345.zap2it.com",
+		Title:   []Title{{Text: "Nightly News"}},
+	}); err != nil {
+		t.Fatalf("WriteProgramme returned error: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+
+	raw, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("ReadFile returned error: %v", err)
+	}
+	out := string(raw)
+
+	for _, tag := range []string{
+		"<sub-title", "<desc", "<credits", "<date", "<length", "<icon",
+		"<url", "<category", "<episode-num", "<video", "<audio", "<new",
+		"<previously-shown", "<subtitles", "<rating", "<star-rating",
+	} {
+		if strings.Contains(out, tag) {
+			t.Errorf("output unexpectedly contains %q for a programme with no such data; got:\n%s", tag, out)
+		}
+	}
+}
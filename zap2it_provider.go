@@ -0,0 +1,630 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// safeGetString safely extracts a string from a map
+func safeGetString(m map[string]interface{}, key string) (string, bool) {
+	val, exists := m[key]
+	if !exists {
+		return "", false
+	}
+	str, ok := val.(string)
+	return str, ok
+}
+
+// safeGetMap safely extracts a nested map from a map
+func safeGetMap(m map[string]interface{}, key string) (map[string]interface{}, bool) {
+	val, exists := m[key]
+	if !exists {
+		return nil, false
+	}
+	subMap, ok := val.(map[string]interface{})
+	return subMap, ok
+}
+
+// safeGetSlice safely extracts a slice from a map
+func safeGetSlice(m map[string]interface{}, key string) ([]interface{}, bool) {
+	val, exists := m[key]
+	if !exists {
+		return nil, false
+	}
+	slice, ok := val.([]interface{})
+	return slice, ok
+}
+
+// zap2itProvider implements Provider against zap2it's TV Listings grid
+// API — the only backend this tool spoke to before [provider] type existed.
+type zap2itProvider struct {
+	z         *Zap
+	zapToken  string
+	headendID string
+
+	// dataMu guards dataCache, an in-process memo of getData results keyed
+	// by window start time. Channels reads the earliest window purely for
+	// its channel list, and Programmes is later asked for that same
+	// window; without this memo both calls would fetch it live, since
+	// cacheTTLFor always treats a near-now window as uncacheable on disk.
+	dataMu    sync.Mutex
+	dataCache map[int64]map[string]interface{}
+}
+
+// lineupHeadend resolves the lineup and headend IDs used both to build
+// data requests and to key the on-disk cache.
+func (p *zap2itProvider) lineupHeadend() (lineupId, headendId string) {
+	lineupId = p.z.config.Section("lineup").Key("lineupId").MustString(p.headendID)
+	headendId = p.z.config.Section("lineup").Key("headendId").MustString("lineupId")
+	return lineupId, headendId
+}
+
+func (p *zap2itProvider) BuildAuthRequest(ctx context.Context) (*http.Request, error) {
+	urlStr := "https://tvlistings.zap2it.com/api/user/login"
+	data := url.Values{
+		"emailid":        {p.z.config.Section("creds").Key("username").String()},
+		"password":       {p.z.config.Section("creds").Key("password").String()},
+		"isfacebookuser": {"false"},
+		"usertype":       {"0"},
+		"objectid":       {""},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", urlStr, strings.NewReader(data.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req, nil
+}
+
+func (p *zap2itProvider) Authenticate(ctx context.Context) error {
+	bodyBytes, err := p.z.doWithRetry(ctx, p.BuildAuthRequest)
+	if err != nil {
+		return fmt.Errorf("error connecting to tvlistings.zap2it.com: %v", err)
+	}
+
+	var authFormVars map[string]interface{}
+	if err := json.Unmarshal(bodyBytes, &authFormVars); err != nil {
+		return fmt.Errorf("error parsing JSON: %v", err)
+	}
+
+	p.zapToken = authFormVars["token"].(string)
+	properties := authFormVars["properties"].(map[string]interface{})
+	p.headendID = properties["2004"].(string)
+	return nil
+}
+
+func (p *zap2itProvider) BuildIDRequest(ctx context.Context) (*http.Request, error) {
+	urlStr := fmt.Sprintf("https://tvlistings.zap2it.com/gapzap_webapi/api/Providers/getPostalCodeProviders/%s/%s/gapzap/%s",
+		p.z.config.Section("prefs").Key("country").String(),
+		p.z.config.Section("prefs").Key("zipCode").String(),
+		p.z.config.Section("prefs").Key("lang").MustString("en-us"))
+
+	req, err := http.NewRequestWithContext(ctx, "GET", urlStr, nil)
+	if err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// FindID looks up candidate headendId/lineupId values for this account's
+// postal code, for --findid. It only applies to zap2it; Schedules Direct
+// lineups and HDHomeRun devices are identified differently.
+func (p *zap2itProvider) FindID() error {
+	bodyBytes, err := p.z.doWithRetry(context.Background(), p.BuildIDRequest)
+	if err != nil {
+		return fmt.Errorf("error loading provider IDs: %v", err)
+	}
+
+	var idVars map[string]interface{}
+	if err := json.Unmarshal(bodyBytes, &idVars); err != nil {
+		return fmt.Errorf("error parsing JSON: %v", err)
+	}
+
+	fmt.Printf("%-15s|%-40s|%-15s|%-15s|%-25s|%-15s\n", "type", "name", "location", "headendID", "lineupId", "device")
+	for _, pr := range idVars["Providers"].([]interface{}) {
+		provider := pr.(map[string]interface{})
+		fmt.Printf("%-15s|%-40s|%-15s|%-15s|%-25s|%-15s\n",
+			provider["type"],
+			provider["name"],
+			provider["location"],
+			provider["headendId"],
+			provider["lineupId"],
+			provider["device"])
+	}
+	return nil
+}
+
+func (p *zap2itProvider) BuildDataRequest(ctx context.Context, currentTime int64) (*http.Request, error) {
+	lineupId, headendId := p.lineupHeadend()
+	device := p.z.config.Section("lineup").Key("device").MustString("-")
+
+	params := url.Values{
+		"Activity_ID":  {"1"},
+		"FromPage":     {"TV Guide"},
+		"AffiliateId":  {"gapzap"},
+		"token":        {p.zapToken},
+		"aid":          {"gapzap"},
+		"lineupId":     {lineupId},
+		"timespan":     {"3"}, // was 3
+		"headendId":    {headendId},
+		"country":      {p.z.config.Section("prefs").Key("country").String()},
+		"device":       {device},
+		"postalCode":   {p.z.config.Section("prefs").Key("zipCode").String()},
+		"isOverride":   {"true"},
+		"time":         {fmt.Sprintf("%d", currentTime*1)}, // was * 1000
+		"pref":         {"m,p"},
+		"userId":       {"-"},
+		"languagecode": {"en-us"},
+		"TMSID":        {""},
+		"OVDID":        {""},
+	}
+
+	urlStr := "https://tvlistings.zap2it.com/api/grid?" + params.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", urlStr, nil)
+	if err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// getData fetches (or reuses a cached copy of) the raw grid JSON for the
+// 3-hour window starting at currentTime. Results are also memoized
+// in-process for the lifetime of p, so a window fetched once (e.g. by
+// Channels) is never fetched live a second time by Programmes.
+func (p *zap2itProvider) getData(ctx context.Context, currentTime int64) (map[string]interface{}, error) {
+	p.dataMu.Lock()
+	if data, ok := p.dataCache[currentTime]; ok {
+		p.dataMu.Unlock()
+		return data, nil
+	}
+	p.dataMu.Unlock()
+
+	lineupId, headendId := p.lineupHeadend()
+	cachePath := p.z.cachePath("zap2it", lineupId, headendId, currentTime)
+	ttl := p.z.cacheTTLFor(currentTime)
+
+	var bodyBytes []byte
+	if cached, ok := p.z.readCache(cachePath, ttl); ok {
+		fmt.Printf("Using cached guide for time: %d\n", currentTime)
+		bodyBytes = cached
+	} else {
+		p.z.limiter.Wait()
+
+		fmt.Printf("Load Guide for time: %d\n", currentTime)
+		fetched, err := p.z.doWithRetry(ctx, func(ctx context.Context) (*http.Request, error) {
+			return p.BuildDataRequest(ctx, currentTime)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error fetching data: %v", err)
+		}
+		bodyBytes = fetched
+
+		if err := p.z.writeCache(cachePath, bodyBytes); err != nil {
+			fmt.Printf("warning: failed to write cache for time %d: %v\n", currentTime, err)
+		}
+	}
+
+	var data map[string]interface{}
+	if err := json.Unmarshal(bodyBytes, &data); err != nil {
+		return nil, fmt.Errorf("error parsing JSON: %v", err)
+	}
+
+	p.dataMu.Lock()
+	if p.dataCache == nil {
+		p.dataCache = map[int64]map[string]interface{}{}
+	}
+	p.dataCache[currentTime] = data
+	p.dataMu.Unlock()
+
+	return data, nil
+}
+
+// Channels fetches the first guide window purely to read off its channel
+// list, since zap2it's grid API bundles channels into every window's
+// response instead of exposing them separately. getData's in-process memo
+// means this fetch is reused by Programmes rather than repeated.
+func (p *zap2itProvider) Channels(ctx context.Context) ([]Channel, error) {
+	startTime, _ := p.z.GetGuideTimes()
+	data, err := p.getData(ctx, startTime)
+	if err != nil {
+		return nil, err
+	}
+
+	channelsData, ok := data["channels"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("channels not found in data")
+	}
+
+	var channels []Channel
+	for _, c := range channelsData {
+		channel, err := p.buildChannelXML(c.(map[string]interface{}))
+		if err != nil {
+			return nil, err
+		}
+		channels = append(channels, channel)
+	}
+	return channels, nil
+}
+
+func (p *zap2itProvider) buildChannelXML(channelData map[string]interface{}) (Channel, error) {
+	channelNo := channelData["channelNo"].(string)
+	callSign := channelData["callSign"].(string)
+	affiliate := channelData["affiliateName"].(string)
+
+	channel := Channel{
+		ID: channelData["channelId"].(string),
+		DisplayName: []string{
+			fmt.Sprintf("%s %s", channelNo, callSign),
+			channelNo,
+			callSign,
+			strings.Title(affiliate),
+		},
+		CallSign:  callSign,
+		ChannelNo: channelNo,
+		Affiliate: affiliate,
+	}
+
+	thumbnail := channelData["thumbnail"].(string)
+	thumbnailURL := "http://" + strings.TrimLeft(strings.Split(thumbnail, "?")[0], "/")
+	channel.Icon = &Icon{Src: thumbnailURL}
+
+	return channel, nil
+}
+
+// Programmes fetches the single 3-hour grid window starting at
+// window.Start and converts every event on every channel into a Programme.
+func (p *zap2itProvider) Programmes(ctx context.Context, window guideWindow) ([]Programme, error) {
+	data, err := p.getData(ctx, window.Start)
+	if err != nil {
+		return nil, err
+	}
+
+	channelsData, ok := data["channels"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("channels not found in data")
+	}
+
+	var programmes []Programme
+	for _, c := range channelsData {
+		channelData := c.(map[string]interface{})
+		channelID := channelData["channelId"].(string)
+		events, ok := channelData["events"].([]interface{})
+		if !ok {
+			continue
+		}
+		for _, e := range events {
+			eventData := e.(map[string]interface{})
+			programme, err := p.buildEventXML(eventData, channelID)
+			if err != nil {
+				return nil, err
+			}
+			programmes = append(programmes, programme)
+		}
+	}
+	return programmes, nil
+}
+
+// zap2itCollectLocalized gathers the base-language text for a program field
+// alongside any per-language overrides zap2it supplies in a "localized"
+// sub-map (e.g. Spanish SAP descriptions, French Canadian titles), keyed by
+// BCP-47 language tag.
+func zap2itCollectLocalized(programData map[string]interface{}, field, baseLang, baseText string) map[string]string {
+	texts := map[string]string{}
+	if baseText != "" {
+		texts[baseLang] = baseText
+	}
+
+	localized, ok := safeGetMap(programData, "localized")
+	if !ok {
+		return texts
+	}
+	for lang, v := range localized {
+		fields, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if text, ok := safeGetString(fields, field); ok && text != "" {
+			texts[lang] = text
+		}
+	}
+	return texts
+}
+
+// zap2itGenreCategories maps zap2it's internal genre labels to the category
+// names most XMLTV consumers (Plex, Kodi, Jellyfin) expect.
+var zap2itGenreCategories = map[string]string{
+	"kids":        "Children's",
+	"children":    "Children's",
+	"news":        "News",
+	"sports":      "Sports event",
+	"sport":       "Sports event",
+	"movie":       "Movie",
+	"film":        "Movie",
+	"talk":        "Talk show",
+	"reality":     "Reality",
+	"documentary": "Documentary",
+	"music":       "Music",
+}
+
+func mapZap2itCategory(genre string) string {
+	if mapped, ok := zap2itGenreCategories[strings.ToLower(genre)]; ok {
+		return mapped
+	}
+	return genre
+}
+
+// buildCategories maps zap2it's pipe-separated genre list onto one or more
+// XMLTV <category> elements, tagged with this guide's resolved language.
+func (p *zap2itProvider) buildCategories(programData map[string]interface{}) []Category {
+	raw, ok := safeGetString(programData, "filter-genres")
+	if !ok || raw == "" {
+		return nil
+	}
+	lang, _ := ResolveLanguage(p.z.langs, map[string]string{"en": raw})
+
+	var categories []Category
+	for _, genre := range strings.Split(raw, "|") {
+		genre = strings.TrimSpace(genre)
+		if genre == "" {
+			continue
+		}
+		categories = append(categories, Category{Lang: lang, Text: mapZap2itCategory(genre)})
+	}
+	return categories
+}
+
+// buildTitles emits one <title lang="..."> per language this guide prefers,
+// using zap2it's base title plus any localized overrides.
+func (p *zap2itProvider) buildTitles(programData map[string]interface{}, baseTitle string) []Title {
+	available := zap2itCollectLocalized(programData, "title", "en", baseTitle)
+	var titles []Title
+	for _, lang := range p.z.selectLanguages(available) {
+		titles = append(titles, Title{Lang: lang, Text: available[lang]})
+	}
+	return titles
+}
+
+// buildSubTitles emits one <sub-title lang="..."> per language this guide
+// prefers, using zap2it's base episode title plus any localized overrides.
+func (p *zap2itProvider) buildSubTitles(programData map[string]interface{}, baseEpisodeTitle string) []SubTitle {
+	available := zap2itCollectLocalized(programData, "episodeTitle", "en", baseEpisodeTitle)
+	var subTitles []SubTitle
+	for _, lang := range p.z.selectLanguages(available) {
+		subTitles = append(subTitles, SubTitle{Lang: lang, Text: available[lang]})
+	}
+	return subTitles
+}
+
+// buildDescs emits one <desc lang="..."> per language this guide prefers,
+// using zap2it's base short description plus any localized overrides.
+func (p *zap2itProvider) buildDescs(programData map[string]interface{}, baseDesc string) []Desc {
+	available := zap2itCollectLocalized(programData, "shortDesc", "en", baseDesc)
+	var descs []Desc
+	for _, lang := range p.z.selectLanguages(available) {
+		descs = append(descs, Desc{Lang: lang, Text: available[lang]})
+	}
+	return descs
+}
+
+// zap2itBuildIcon builds the programme artwork icon, preferring the
+// program's preferred image over its plain thumbnail.
+func zap2itBuildIcon(programData map[string]interface{}) *Icon {
+	thumbnail, ok := safeGetString(programData, "preferredImage")
+	if !ok || thumbnail == "" {
+		thumbnail, ok = safeGetString(programData, "thumbnail")
+		if !ok || thumbnail == "" {
+			return nil
+		}
+	}
+	src := "http://" + strings.TrimLeft(strings.Split(thumbnail, "?")[0], "/")
+	return &Icon{Src: src}
+}
+
+// zap2itBuildEpisodeNums emits both the xmltv_ns (zero-based) and onscreen
+// (human-readable) episode numbering systems, plus the Tribune/Gracenote
+// program ID when present.
+func zap2itBuildEpisodeNums(eventData, programData map[string]interface{}) []EpisodeNum {
+	var nums []EpisodeNum
+
+	season, hasSeason := safeGetString(eventData, "seasonNum")
+	episode, hasEpisode := safeGetString(eventData, "episodeNum")
+	if hasSeason && hasEpisode && season != "" && episode != "" {
+		seasonNum, seasonErr := strconv.Atoi(season)
+		episodeNum, episodeErr := strconv.Atoi(episode)
+		if seasonErr == nil && episodeErr == nil {
+			nums = append(nums, EpisodeNum{
+				System: "xmltv_ns",
+				Text:   fmt.Sprintf("%d.%d.", seasonNum-1, episodeNum-1),
+			})
+		}
+		nums = append(nums, EpisodeNum{
+			System: "onscreen",
+			Text:   fmt.Sprintf("S%sE%s", season, episode),
+		})
+	}
+
+	if tmsID, ok := safeGetString(programData, "tmsId"); ok && tmsID != "" {
+		nums = append(nums, EpisodeNum{System: "dd_progid", Text: tmsID})
+	}
+
+	return nums
+}
+
+// zap2itBuildCredits maps zap2it's topCast list onto <credits>, bucketing
+// each member by their role.
+func zap2itBuildCredits(programData map[string]interface{}) *Credits {
+	cast, ok := safeGetSlice(programData, "topCast")
+	if !ok || len(cast) == 0 {
+		return nil
+	}
+
+	credits := &Credits{}
+	for _, c := range cast {
+		member, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, ok := safeGetString(member, "name")
+		if !ok || name == "" {
+			continue
+		}
+		role, _ := safeGetString(member, "role")
+		switch strings.ToLower(role) {
+		case "director":
+			credits.Director = append(credits.Director, name)
+		case "writer":
+			credits.Writer = append(credits.Writer, name)
+		case "producer", "executive producer":
+			credits.Producer = append(credits.Producer, name)
+		case "guest star", "guest":
+			credits.Guest = append(credits.Guest, name)
+		default:
+			credits.Actor = append(credits.Actor, Actor{Role: role, Text: name})
+		}
+	}
+
+	if len(credits.Director) == 0 && len(credits.Actor) == 0 && len(credits.Writer) == 0 &&
+		len(credits.Producer) == 0 && len(credits.Guest) == 0 {
+		return nil
+	}
+	return credits
+}
+
+// zap2itBuildDate returns the program's original release/air year, if
+// zap2it provided one.
+func zap2itBuildDate(programData map[string]interface{}) *Date {
+	year, ok := safeGetString(programData, "releaseYear")
+	if !ok || year == "" {
+		return nil
+	}
+	return &Date{Text: year}
+}
+
+// zap2itBuildQualityFlags translates zap2it's event-level flag/tags lists
+// into the XMLTV <video>, <audio> and <subtitles> elements.
+func zap2itBuildQualityFlags(eventData map[string]interface{}) (*Video, *Audio, *Subtitles) {
+	flags, _ := safeGetSlice(eventData, "flag")
+	tags, _ := safeGetSlice(eventData, "tags")
+
+	var video *Video
+	var audio *Audio
+	var subtitles *Subtitles
+	for _, f := range append(flags, tags...) {
+		flag, ok := f.(string)
+		if !ok {
+			continue
+		}
+		switch strings.ToUpper(flag) {
+		case "HD", "HDTV":
+			video = &Video{Quality: "HDTV"}
+		case "DD 5.1", "DD5.1", "DOLBY 5.1":
+			audio = &Audio{Stereo: "dolby digital"}
+		case "STEREO":
+			if audio == nil {
+				audio = &Audio{Stereo: "stereo"}
+			}
+		case "CC":
+			subtitles = &Subtitles{Type: "teletext"}
+		}
+	}
+	return video, audio, subtitles
+}
+
+// zap2itBuildRating maps zap2it's rating string to the appropriate XMLTV
+// rating system: MPAA for film ratings, VCHIP for TV parental guidelines.
+func zap2itBuildRating(eventData map[string]interface{}) *Rating {
+	value, ok := safeGetString(eventData, "rating")
+	if !ok || value == "" {
+		return nil
+	}
+	system := "VCHIP"
+	for _, prefix := range []string{"G", "PG", "R", "NC-17", "NR"} {
+		if strings.HasPrefix(value, prefix) {
+			system = "MPAA"
+			break
+		}
+	}
+	return &Rating{System: system, Value: &Value{Text: value}}
+}
+
+// zap2itBuildStarRating converts zap2it's 0-4 star rating into an XMLTV
+// <star-rating>.
+func zap2itBuildStarRating(programData map[string]interface{}) *StarRating {
+	stars, ok := safeGetString(programData, "starRating")
+	if !ok || stars == "" {
+		return nil
+	}
+	return &StarRating{Value: &Value{Text: stars + "/4"}}
+}
+
+func (p *zap2itProvider) buildEventXML(eventData map[string]interface{}, channelID string) (Programme, error) {
+	if eventData == nil {
+		return Programme{}, fmt.Errorf("eventData is nil")
+	}
+
+	programme := Programme{Channel: channelID}
+
+	// Handle start and end times
+	startTime, ok := safeGetString(eventData, "startTime")
+	if !ok {
+		return Programme{}, fmt.Errorf("invalid or missing startTime")
+	}
+	programme.Start = zap2itBuildXMLDate(startTime)
+
+	endTime, ok := safeGetString(eventData, "endTime")
+	if !ok {
+		return Programme{}, fmt.Errorf("invalid or missing endTime")
+	}
+	programme.Stop = zap2itBuildXMLDate(endTime)
+
+	// Extract program data
+	programData, ok := safeGetMap(eventData, "program")
+	if !ok {
+		return Programme{}, fmt.Errorf("invalid or missing program data")
+	}
+
+	// Set title
+	title, ok := safeGetString(programData, "title")
+	if !ok {
+		return Programme{}, fmt.Errorf("invalid or missing title")
+	}
+	programme.Title = p.buildTitles(programData, title)
+
+	// Set episode title if available
+	episodeTitle, _ := safeGetString(programData, "episodeTitle")
+	programme.SubTitle = p.buildSubTitles(programData, episodeTitle)
+
+	// Set description
+	shortDesc, ok := safeGetString(programData, "shortDesc")
+	if !ok || shortDesc == "" {
+		shortDesc = "Unavailable"
+	}
+	programme.Desc = p.buildDescs(programData, shortDesc)
+
+	programme.Credits = zap2itBuildCredits(programData)
+	programme.Date = zap2itBuildDate(programData)
+	programme.Icon = zap2itBuildIcon(programData)
+	programme.Categories = p.buildCategories(programData)
+	programme.EpisodeNums = zap2itBuildEpisodeNums(eventData, programData)
+	programme.Video, programme.Audio, programme.Subtitles = zap2itBuildQualityFlags(eventData)
+	programme.Rating = zap2itBuildRating(eventData)
+	programme.StarRating = zap2itBuildStarRating(programData)
+
+	return programme, nil
+}
+
+func zap2itBuildXMLDate(inTime string) string {
+	output := strings.ReplaceAll(inTime, "-", "")
+	output = strings.ReplaceAll(output, "T", "")
+	output = strings.ReplaceAll(output, ":", "")
+	output = strings.Replace(output, "Z", " +0000", 1)
+	return output
+}
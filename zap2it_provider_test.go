@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gopkg.in/ini.v1"
+)
+
+func TestZap2itBuildXMLDate(t *testing.T) {
+	got := zap2itBuildXMLDate("2026-07-28T12:00:00Z")
+	want := "20260728120000 +0000"
+	if got != want {
+		t.Errorf("zap2itBuildXMLDate = %q, want %q", got, want)
+	}
+}
+
+func TestZap2itBuildEpisodeNums(t *testing.T) {
+	eventData := map[string]interface{}{"seasonNum": "2", "episodeNum": "5"}
+	programData := map[string]interface{}{"tmsId": "EP012345"}
+
+	nums := zap2itBuildEpisodeNums(eventData, programData)
+
+	want := []EpisodeNum{
+		{System: "xmltv_ns", Text: "1.4."},
+		{System: "onscreen", Text: "S2E5"},
+		{System: "dd_progid", Text: "EP012345"},
+	}
+	if len(nums) != len(want) {
+		t.Fatalf("zap2itBuildEpisodeNums = %+v, want %+v", nums, want)
+	}
+	for i := range want {
+		if nums[i] != want[i] {
+			t.Errorf("nums[%d] = %+v, want %+v", i, nums[i], want[i])
+		}
+	}
+}
+
+func TestZap2itBuildEpisodeNumsWithoutSeasonInfo(t *testing.T) {
+	nums := zap2itBuildEpisodeNums(map[string]interface{}{}, map[string]interface{}{})
+	if nums != nil {
+		t.Errorf("zap2itBuildEpisodeNums = %+v, want nil", nums)
+	}
+}
+
+func TestZap2itBuildCreditsBucketsByRole(t *testing.T) {
+	programData := map[string]interface{}{
+		"topCast": []interface{}{
+			map[string]interface{}{"name": "Jane Director", "role": "Director"},
+			map[string]interface{}{"name": "Writer One", "role": "Writer"},
+			map[string]interface{}{"name": "Producer One", "role": "Executive Producer"},
+			map[string]interface{}{"name": "Guest One", "role": "Guest Star"},
+			map[string]interface{}{"name": "John Host", "role": "Host"},
+		},
+	}
+
+	credits := zap2itBuildCredits(programData)
+	if credits == nil {
+		t.Fatal("zap2itBuildCredits = nil, want populated Credits")
+	}
+	if len(credits.Director) != 1 || credits.Director[0] != "Jane Director" {
+		t.Errorf("Director = %v, want [Jane Director]", credits.Director)
+	}
+	if len(credits.Writer) != 1 || credits.Writer[0] != "Writer One" {
+		t.Errorf("Writer = %v, want [Writer One]", credits.Writer)
+	}
+	if len(credits.Producer) != 1 || credits.Producer[0] != "Producer One" {
+		t.Errorf("Producer = %v, want [Producer One]", credits.Producer)
+	}
+	if len(credits.Guest) != 1 || credits.Guest[0] != "Guest One" {
+		t.Errorf("Guest = %v, want [Guest One]", credits.Guest)
+	}
+	if len(credits.Actor) != 1 || credits.Actor[0] != (Actor{Role: "Host", Text: "John Host"}) {
+		t.Errorf("Actor = %v, want [{Host John Host}]", credits.Actor)
+	}
+}
+
+func TestZap2itBuildCreditsReturnsNilForEmptyCast(t *testing.T) {
+	if credits := zap2itBuildCredits(map[string]interface{}{}); credits != nil {
+		t.Errorf("zap2itBuildCredits = %+v, want nil", credits)
+	}
+}
+
+func TestZap2itBuildQualityFlags(t *testing.T) {
+	eventData := map[string]interface{}{
+		"flag": []interface{}{"HD", "CC"},
+		"tags": []interface{}{"DD 5.1"},
+	}
+	video, audio, subtitles := zap2itBuildQualityFlags(eventData)
+	if video == nil || video.Quality != "HDTV" {
+		t.Errorf("video = %+v, want Quality=HDTV", video)
+	}
+	if audio == nil || audio.Stereo != "dolby digital" {
+		t.Errorf("audio = %+v, want Stereo=dolby digital", audio)
+	}
+	if subtitles == nil || subtitles.Type != "teletext" {
+		t.Errorf("subtitles = %+v, want Type=teletext", subtitles)
+	}
+}
+
+func TestZap2itBuildRating(t *testing.T) {
+	cases := []struct {
+		value      string
+		wantSystem string
+	}{
+		{"PG-13", "MPAA"},
+		{"TV-MA", "VCHIP"},
+	}
+	for _, c := range cases {
+		rating := zap2itBuildRating(map[string]interface{}{"rating": c.value})
+		if rating == nil || rating.System != c.wantSystem || rating.Value.Text != c.value {
+			t.Errorf("zap2itBuildRating(%q) = %+v, want System=%q Value=%q", c.value, rating, c.wantSystem, c.value)
+		}
+	}
+	if rating := zap2itBuildRating(map[string]interface{}{}); rating != nil {
+		t.Errorf("zap2itBuildRating with no rating = %+v, want nil", rating)
+	}
+}
+
+func TestZap2itBuildStarRating(t *testing.T) {
+	rating := zap2itBuildStarRating(map[string]interface{}{"starRating": "3"})
+	if rating == nil || rating.Value.Text != "3/4" {
+		t.Errorf("zap2itBuildStarRating = %+v, want Value=3/4", rating)
+	}
+	if rating := zap2itBuildStarRating(map[string]interface{}{}); rating != nil {
+		t.Errorf("zap2itBuildStarRating with no rating = %+v, want nil", rating)
+	}
+}
+
+func TestMapZap2itCategory(t *testing.T) {
+	if got := mapZap2itCategory("Sports"); got != "Sports event" {
+		t.Errorf("mapZap2itCategory(Sports) = %q, want %q", got, "Sports event")
+	}
+	if got := mapZap2itCategory("Unknown Genre"); got != "Unknown Genre" {
+		t.Errorf("mapZap2itCategory(Unknown Genre) = %q, want it unchanged", got)
+	}
+}
+
+func TestBuildEventXMLMapsEveryField(t *testing.T) {
+	p := &zap2itProvider{z: &Zap{langs: []string{"en"}}}
+
+	eventData := map[string]interface{}{
+		"startTime":  "2026-07-28T12:00:00Z",
+		"endTime":    "2026-07-28T13:00:00Z",
+		"seasonNum":  "1",
+		"episodeNum": "1",
+		"flag":       []interface{}{"HD"},
+		"rating":     "TV-PG",
+		"program": map[string]interface{}{
+			"title":         "SportsCenter",
+			"shortDesc":     "Highlights",
+			"filter-genres": "Sports",
+			"starRating":    "4",
+			"tmsId":         "EP000001",
+		},
+	}
+
+	programme, err := p.buildEventXML(eventData, "chan-1")
+	if err != nil {
+		t.Fatalf("buildEventXML returned error: %v", err)
+	}
+
+	if programme.Channel != "chan-1" {
+		t.Errorf("Channel = %q, want chan-1", programme.Channel)
+	}
+	if programme.Start != "20260728120000 +0000" || programme.Stop != "20260728130000 +0000" {
+		t.Errorf("Start/Stop = %q/%q, want mapped UTC timestamps", programme.Start, programme.Stop)
+	}
+	if len(programme.Title) != 1 || programme.Title[0].Text != "SportsCenter" {
+		t.Errorf("Title = %+v, want SportsCenter", programme.Title)
+	}
+	if len(programme.Desc) != 1 || programme.Desc[0].Text != "Highlights" {
+		t.Errorf("Desc = %+v, want Highlights", programme.Desc)
+	}
+	if len(programme.Categories) != 1 || programme.Categories[0].Text != "Sports event" {
+		t.Errorf("Categories = %+v, want Sports event", programme.Categories)
+	}
+	if programme.Video == nil || programme.Video.Quality != "HDTV" {
+		t.Errorf("Video = %+v, want HDTV", programme.Video)
+	}
+	if programme.Rating == nil || programme.Rating.Value.Text != "TV-PG" {
+		t.Errorf("Rating = %+v, want TV-PG", programme.Rating)
+	}
+	if programme.StarRating == nil || programme.StarRating.Value.Text != "4/4" {
+		t.Errorf("StarRating = %+v, want 4/4", programme.StarRating)
+	}
+	if len(programme.EpisodeNums) != 3 {
+		t.Errorf("EpisodeNums = %+v, want 3 entries (xmltv_ns, onscreen, dd_progid)", programme.EpisodeNums)
+	}
+}
+
+func TestGetDataMemoizesWithinProcess(t *testing.T) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Write([]byte(`{"channels":[]}`))
+	}))
+	defer server.Close()
+
+	target, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("url.Parse returned error: %v", err)
+	}
+	z := &Zap{
+		httpClient: &http.Client{Transport: &rewriteTransport{target: target}},
+		limiter:    newRateLimiter(1000),
+		cacheDir:   t.TempDir(),
+		cacheTTL:   time.Hour,
+		config:     ini.Empty(),
+	}
+	p := &zap2itProvider{z: z, zapToken: "tok"}
+
+	ctx := context.Background()
+	if _, err := p.getData(ctx, 1000); err != nil {
+		t.Fatalf("getData returned error: %v", err)
+	}
+	if _, err := p.getData(ctx, 1000); err != nil {
+		t.Fatalf("second getData returned error: %v", err)
+	}
+
+	if got := atomic.LoadInt32(&hits); got != 1 {
+		t.Errorf("grid endpoint was hit %d times, want 1 (second call should reuse the in-process memo)", got)
+	}
+}